@@ -2,132 +2,173 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"log/slog"
 	"net/http"
 	"reflect"
-	"strconv"
-
-	sloghttp "github.com/samber/slog-http"
 )
 
-// APIError is an error type that is returned when an API request fails.
-type APIError struct {
-	StatusCode int
-	Message    string
+// MakeAPIRequest is a generic function to make an API request. It supports any method, see the Method constants.
+func MakeAPIRequest(client *http.Client, kind, apiBaseURL, endpoint, token string, request, response interface{}) error {
+	return MakeAPIRequestWithContext(context.Background(), client, kind, apiBaseURL, endpoint, token, request, response)
 }
 
-func (e *APIError) Error() string {
-	return "API request failed with status code " + strconv.Itoa(e.StatusCode) + ": " + e.Message
+// MakeAPIRequestWithContext is the same as MakeAPIRequest but binds the request to ctx, cancelling ctx aborts the request.
+func MakeAPIRequestWithContext(ctx context.Context, client *http.Client, kind, apiBaseURL, endpoint, token string, request, response interface{}) error {
+	c := AuthenticatedAPIClient{
+		BaseURL: apiBaseURL,
+		Token:   token,
+		Client:  client,
+	}
+
+	return c.makeRequest(ctx, kind, endpoint, request, response)
 }
 
-// MakeAPIRequest is a generic function to make an API request. It supports GET, POST, PUT, and DELETE requests.
-func MakeAPIRequest(client *http.Client, kind, apiBaseURL, endpoint, token string, request, response interface{}) error {
-	l := slog.Default().With("kind", kind, "apiBaseURL", apiBaseURL, "endpoint", endpoint)
-	// If response is not nil, check its a pointer (easy dev mistake to make).
-	if reflect.ValueOf(response).Kind() != reflect.Ptr {
-		return &DeveloperError{"response provided must be a pointer"}
+// makeRequest builds the request for the given endpoint, sends it using the client's settings and decodes the response.
+func (c *AuthenticatedAPIClient) makeRequest(ctx context.Context, kind, endpoint string, request, response interface{}) error {
+	_, err := c.doRequest(ctx, kind, endpoint, request, response)
+	return err
+}
+
+// doRequest is makeRequest also returning the headers of a successful response.
+func (c *AuthenticatedAPIClient) doRequest(ctx context.Context, kind, endpoint string, request, response interface{}) (http.Header, error) {
+	l := slog.Default().With("kind", kind, "apiBaseURL", c.BaseURL, "endpoint", endpoint)
+	// If response is not nil, check its a pointer or a writer to stream into (easy dev mistake to make).
+	if _, ok := response.(io.Writer); !ok && reflect.ValueOf(response).Kind() != reflect.Ptr {
+		return nil, &DeveloperError{"response provided must be a pointer"}
 	}
 
-	var jsonData []byte
-	var err error
+	req, err := c.newRequest(ctx, l, kind, endpoint, request)
+	if err != nil {
+		return nil, err
+	}
+	if req.Body != nil {
+		// The transport closes the body once sent, this covers returning before that, so streamed bodies stop producing.
+		defer req.Body.Close()
+	}
 
-	if request != nil {
-		if kind == "GET" || kind == "DELETE" {
-			l.Error("GET and DELETE requests do not support request bodies", "kind", kind)
-			return &DeveloperError{"GET and DELETE requests do not support request bodies"}
+	// The breaker and the limiter only guard requests reaching the server, responses served from the cache bypass both.
+	release := func() {}
+	defer func() { release() }()
+	resp, err := c.Cache.send(req, func(req *http.Request) (*http.Response, error) {
+		done, err := c.Breaker.allow(ctx)
+		if err != nil {
+			return nil, err
 		}
+		if release, err = c.Limiter.acquire(ctx); err != nil {
+			release = func() {}
+			done(nil, err)
+			return nil, err
+		}
+		resp, err := c.sendLimited(req)
+		done(resp, err)
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
-		jsonData, err = json.Marshal(request)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, err := readErrorBody(resp.Body)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		return nil, newAPIError(resp, body)
 	}
 
-	var req *http.Request
-
-	if request != nil {
-		buf := bytes.NewBuffer(jsonData)
-		req, err = http.NewRequest(kind, apiBaseURL+endpoint, buf)
-	} else {
-		req, err = http.NewRequest(kind, apiBaseURL+endpoint, nil)
+	if err := c.decodeResponse(l, resp, response); err != nil {
+		return nil, err
 	}
 
-	if err != nil {
-		return err
-	}
+	return resp.Header, nil
+}
 
-	if token != "" {
-		req.Header.Set("Authorization", "Bearer "+token)
-	}
+// newRequest builds an authenticated request for endpoint with request encoded as its body.
+func (c *AuthenticatedAPIClient) newRequest(ctx context.Context, l *slog.Logger, kind, endpoint string, request interface{}) (*http.Request, error) {
+	var body io.Reader
+	var contentType string
+	var err error
 
 	if request != nil {
-		req.Header.Set("Content-Type", "application/json")
-	}
+		if !c.allowsBody(kind) {
+			l.Error("Request method does not support request bodies", "kind", kind)
+			return nil, &DeveloperError{kind + " requests do not support request bodies"}
+		}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
+		if encoder, ok := request.(RequestBody); ok {
+			body, contentType, err = encoder.Encode()
+		} else {
+			var jsonData []byte
+			jsonData, err = json.Marshal(request)
+			body, contentType = bytes.NewBuffer(jsonData), "application/json"
+		}
+		if err != nil {
+			return nil, err
+		}
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	req, err := http.NewRequestWithContext(ctx, kind, c.URL(endpoint), body)
 	if err != nil {
-		return err
+		// Streamed bodies such as MultipartBody produce from a goroutine until closed.
+		if closer, ok := body.(io.Closer); ok {
+			closer.Close()
+		}
+		return nil, err
 	}
 
-	if err := json.Unmarshal(body, &response); err != nil {
-		l.Error("Failed to unmarshal response", "error", err, "body", string(body))
-		return err
+	if auth := c.authenticator(); auth != nil {
+		if err := auth.Authenticate(req); err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, err
+		}
 	}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return &APIError{StatusCode: resp.StatusCode, Message: string(body)}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if key := c.idempotencyKey(ctx, kind); key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
 	}
 
-	return nil
+	return req, nil
 }
 
 // MakeDeleteRequest is a helper function to make a DELETE request to the specified endpoint. If token is not "" it will be added to the request as a Bearer token.
 func MakeDeleteRequest(client *http.Client, apiBaseURL, endpoint, token string, response interface{}) error {
-	return MakeAPIRequest(client, "DELETE", apiBaseURL, endpoint, token, nil, response)
+	return MakeAPIRequest(client, http.MethodDelete, apiBaseURL, endpoint, token, nil, response)
 }
 
 // MakeGetRequest is a helper function to make a GET request to the specified endpoint. If token is not "" it will be added to the request as a Bearer token.
 func MakeGetRequest(client *http.Client, apiBaseURL, endpoint, token string, response interface{}) error {
-	return MakeAPIRequest(client, "GET", apiBaseURL, endpoint, token, nil, response)
+	return MakeAPIRequest(client, http.MethodGet, apiBaseURL, endpoint, token, nil, response)
 }
 
 // MakePostRequest is a helper function to make a POST request to the specified endpoint. If token is not "" it will be added to the request as a Bearer token.
 func MakePostRequest(client *http.Client, apiBaseURL, endpoint, token string, request, response interface{}) error {
-	return MakeAPIRequest(client, "POST", apiBaseURL, endpoint, token, request, response)
+	return MakeAPIRequest(client, http.MethodPost, apiBaseURL, endpoint, token, request, response)
 }
 
 // MakePutRequest is a helper function to make a PUT request to the specified endpoint. If token is not "" it will be added to the request as a Bearer token.
 func MakePutRequest(client *http.Client, apiBaseURL, endpoint, token string, request, response interface{}) error {
-	return MakeAPIRequest(client, "PUT", apiBaseURL, endpoint, token, request, response)
+	return MakeAPIRequest(client, http.MethodPut, apiBaseURL, endpoint, token, request, response)
 }
 
 // RunAPIServer attaches logging middleware to the default http server and starts it on the specified port.
-func RunAPIServer(port int) {
-	l := slog.Default()
-
-	// mux router
-	mux := http.NewServeMux()
-
-	// Include the default mux in your custom mux
-	mux.Handle("/", http.DefaultServeMux)
-
-	// Middleware
-	l.Info("Setting up middleware for API server")
-	handler := sloghttp.Recovery(mux)
-	handler = sloghttp.New(l)(handler)
-
-	// Start server
-	addr := fmt.Sprintf(":%d", port)
-	l.Info("Starting API server", "port", port)
-	log.Fatal(http.ListenAndServe(addr, handler))
+// It blocks until SIGINT or SIGTERM is received, then drains in-flight requests for DefaultGracePeriod.
+// Failing to listen or serve is returned rather than exiting the process.
+//
+// It only exists for handlers registered on http.DefaultServeMux, new code should use a ServerBuilder.
+// The probe and metrics endpoints of a ServerBuilder are only added for paths http.DefaultServeMux does not serve.
+func RunAPIServer(port int) error {
+	b := newServerBuilder(http.DefaultServeMux)
+	b.Handle("/", http.DefaultServeMux)
+
+	slog.Default().Info("Starting API server", "port", port)
+	return b.Build(fmt.Sprintf(":%d", port)).Run(context.Background())
 }
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// APIError is an error type that is returned when an API request fails.
+type APIError struct {
+	StatusCode int
+	// Message is the raw response body, cut down to its first 512 bytes.
+	Message string
+	Method  string
+	// URL is the request URL with credentials in the user info and query string redacted.
+	URL    string
+	Header http.Header
+	// RequestID is the server assigned request ID taken from the usual response headers, "" if there was none.
+	RequestID string
+	// Body is the response body parsed as a JSON error payload, nil if the body is not one.
+	Body *APIErrorBody
+}
+
+// APIErrorBody is the JSON error payload returned by many APIs, e.g. Vikunja's {"code": 404, "message": "..."}.
+type APIErrorBody struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	// Error is used instead of Message by some APIs.
+	Error string `json:"error"`
+}
+
+func (e *APIError) Error() string {
+	msg := "API request failed with status code " + strconv.Itoa(e.StatusCode)
+	if e.Method != "" || e.URL != "" {
+		msg = strings.TrimSpace(e.Method+" "+e.URL) + ": " + msg
+	}
+	if e.Body != nil && e.Body.Message != "" {
+		return msg + ": " + e.Body.Message
+	}
+	if e.Body != nil && e.Body.Error != "" {
+		return msg + ": " + e.Body.Error
+	}
+	return msg + ": " + e.Message
+}
+
+// requestIDHeaders are the response headers commonly used to carry a request ID, in order of preference.
+var requestIDHeaders = []string{"X-Request-Id", "X-Correlation-Id", "Request-Id", "X-Amzn-Trace-Id"}
+
+// newAPIError builds an APIError from a non-2xx response and its already read body.
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    bodySnippet(body),
+		Header:     resp.Header,
+	}
+
+	if req := resp.Request; req != nil {
+		apiErr.Method = req.Method
+		apiErr.URL = redactURL(req.URL)
+	}
+
+	for _, header := range requestIDHeaders {
+		if id := resp.Header.Get(header); id != "" {
+			apiErr.RequestID = id
+			break
+		}
+	}
+
+	payload := APIErrorBody{}
+	if err := json.Unmarshal(body, &payload); err == nil && payload != (APIErrorBody{}) {
+		apiErr.Body = &payload
+	}
+
+	return apiErr
+}
+
+// sensitiveQueryParams are query string parameters whose values are replaced by redactURL.
+var sensitiveQueryParams = []string{"token", "access_token", "api_key", "apikey", "key", "secret", "client_secret", "password", "signature"}
+
+// redactURL returns u as a string with the user info password and the values of sensitive query parameters redacted.
+func redactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+
+	redacted := *u
+	if u.RawQuery != "" {
+		query := u.Query()
+		for param := range query {
+			if ArrContains(sensitiveQueryParams, strings.ToLower(param)) {
+				query.Set(param, "xxxxx")
+			}
+		}
+		redacted.RawQuery = query.Encode()
+	}
+
+	return redacted.Redacted()
+}
+
+// IsNotFound reports whether err is, or wraps, an APIError with status 404.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsUnauthorized reports whether err is, or wraps, an APIError with status 401.
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// IsForbidden reports whether err is, or wraps, an APIError with status 403.
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusForbidden)
+}
+
+// IsRetryable reports whether err is, or wraps, an APIError whose status suggests trying again later may succeed.
+func IsRetryable(err error) bool {
+	return hasStatus(err, http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout)
+}
+
+// hasStatus reports whether err is, or wraps, an APIError with one of the given status codes.
+func hasStatus(err error, statusCodes ...int) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return ArrContains(statusCodes, apiErr.StatusCode)
+}
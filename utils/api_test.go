@@ -1,11 +1,41 @@
 package utils
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
+// cassetteClient returns a client for baseURL that replays testdata/<name>.json,
+// run the tests with GOCORE_RECORD_CASSETTES=1 to record the cassette against the live API instead.
+func cassetteClient(t *testing.T, baseURL, name string) AuthenticatedAPIClient {
+	t.Helper()
+
+	mode := CassetteReplay
+	if os.Getenv("GOCORE_RECORD_CASSETTES") != "" {
+		mode = CassetteRecord
+	}
+
+	cassette, err := LoadCassette(filepath.Join("testdata", name+".json"), mode)
+	if err != nil {
+		t.Fatalf("Error loading cassette: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := cassette.Save(); err != nil {
+			t.Errorf("Error saving cassette: %v", err)
+		}
+	})
+
+	return NewAPIClient(baseURL, "", WithMiddleware(cassette.Middleware()))
+}
+
 func TestSimpleGetReq(t *testing.T) {
-	apiClient := NewAPIClient("http://postman-echo.com", "")
+	apiClient := cassetteClient(t, "http://postman-echo.com", "postman_echo_get")
 
 	resp := map[string]interface{}{}
 	if err := apiClient.Get("/get", &resp); err != nil {
@@ -28,7 +58,12 @@ func TestSimpleGetReq(t *testing.T) {
 }
 
 func TestAccidentalNonPointerResp(t *testing.T) {
-	apiClient := NewAPIClient("http://postman-echo.com", "")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "")
 
 	resp := interface{}(nil)
 	err := apiClient.Get("/get", resp)
@@ -45,3 +80,25 @@ func TestAccidentalNonPointerResp(t *testing.T) {
 		t.Errorf("Expected error to be of type DeveloperError")
 	}
 }
+
+func TestGetWithContextCancelled(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	resp := map[string]interface{}{}
+	err := apiClient.GetWithContext(ctx, "/slow", &resp)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authenticator adds credentials to an outgoing request. AuthenticatedAPIClient calls it once per request before sending.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// BearerAuth authenticates requests with an "Authorization: Bearer <token>" header.
+type BearerAuth struct {
+	Token string
+}
+
+// Authenticate sets the Authorization header, an empty token leaves the request untouched.
+func (a BearerAuth) Authenticate(req *http.Request) error {
+	if a.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	}
+	return nil
+}
+
+// BasicAuth authenticates requests with HTTP basic authentication.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// Authenticate sets the basic authentication header.
+func (a BasicAuth) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+// HeaderKeyAuth authenticates requests by putting an API key into a custom header, e.g. "X-API-Key".
+type HeaderKeyAuth struct {
+	Header string
+	Key    string
+}
+
+// Authenticate sets the configured header to the key.
+func (a HeaderKeyAuth) Authenticate(req *http.Request) error {
+	if a.Header == "" {
+		return &DeveloperError{"HeaderKeyAuth requires a header name"}
+	}
+	req.Header.Set(a.Header, a.Key)
+	return nil
+}
+
+// QueryKeyAuth authenticates requests by adding an API key as a query string parameter, e.g. "?api_key=...".
+type QueryKeyAuth struct {
+	Param string
+	Key   string
+}
+
+// Authenticate adds the key to the request URL's query string, replacing any existing value of the parameter.
+func (a QueryKeyAuth) Authenticate(req *http.Request) error {
+	if a.Param == "" {
+		return &DeveloperError{"QueryKeyAuth requires a query parameter name"}
+	}
+	query := req.URL.Query()
+	query.Set(a.Param, a.Key)
+	req.URL.RawQuery = query.Encode()
+	return nil
+}
+
+// ClientCredentialsAuth authenticates requests with an OAuth2 access token obtained via the client credentials grant.
+// The token is cached and fetched again shortly before it expires, it is safe for concurrent use.
+type ClientCredentialsAuth struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// Client is used to call the token endpoint, http.DefaultClient is used when nil.
+	Client *http.Client
+	// ExpiryDelta is how long before the reported expiry the token is considered expired, to absorb clock skew and latency.
+	// It is capped at half the token's lifetime, so short-lived tokens are still reused.
+	ExpiryDelta time.Duration
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+	// refresh is the token fetch in progress, callers needing a token wait for it rather than fetching their own.
+	refresh *tokenRefresh
+}
+
+// tokenRefresh is a token fetch callers wait for, token and err are set before done is closed.
+type tokenRefresh struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// tokenFetchTimeout bounds a token fetch, which does not stop when the caller that started it gives up.
+const tokenFetchTimeout = 30 * time.Second
+
+// NewClientCredentialsAuth creates a ClientCredentialsAuth that refreshes its token 30 seconds before expiry.
+func NewClientCredentialsAuth(tokenURL, clientID, clientSecret string, scopes ...string) *ClientCredentialsAuth {
+	return &ClientCredentialsAuth{
+		TokenURL:     tokenURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+		ExpiryDelta:  30 * time.Second,
+	}
+}
+
+// clientCredentialsToken is the token endpoint response as described in RFC 6749 section 5.1.
+type clientCredentialsToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Authenticate sets a Bearer Authorization header, fetching a new access token first if the cached one has expired.
+func (a *ClientCredentialsAuth) Authenticate(req *http.Request) error {
+	token, err := a.Token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Token returns the cached access token, fetching a new one from the token endpoint if there is none or it has expired.
+// Concurrent callers share a single fetch, cancelling ctx only stops the caller waiting for it.
+func (a *ClientCredentialsAuth) Token(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	if a.token != "" && (a.expiry.IsZero() || time.Now().Before(a.expiry)) {
+		token := a.token
+		a.mu.Unlock()
+		return token, nil
+	}
+	refresh := a.refresh
+	if refresh == nil {
+		refresh = &tokenRefresh{done: make(chan struct{})}
+		a.refresh = refresh
+		// The fetch keeps ctx's values, e.g. its trace, but not its cancellation, as other callers may wait for it.
+		go a.refreshToken(context.WithoutCancel(ctx), refresh)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-refresh.done:
+		return refresh.token, refresh.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// refreshToken fetches a new token, caches it and hands it to the callers waiting on refresh.
+func (a *ClientCredentialsAuth) refreshToken(ctx context.Context, refresh *tokenRefresh) {
+	ctx, cancel := context.WithTimeout(ctx, tokenFetchTimeout)
+	defer cancel()
+	token, err := a.fetchToken(ctx)
+
+	a.mu.Lock()
+	if err == nil {
+		a.token = token.AccessToken
+		a.expiry = time.Time{}
+		if token.ExpiresIn > 0 {
+			lifetime := time.Duration(token.ExpiresIn) * time.Second
+			a.expiry = time.Now().Add(lifetime - min(a.ExpiryDelta, lifetime/2))
+		}
+	}
+	a.refresh = nil
+	a.mu.Unlock()
+
+	refresh.token, refresh.err = token.AccessToken, err
+	close(refresh.done)
+}
+
+// Invalidate drops the cached token so the next request fetches a new one, useful after the API rejected it.
+func (a *ClientCredentialsAuth) Invalidate() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.token = ""
+	a.expiry = time.Time{}
+}
+
+// fetchToken requests a new access token from the token endpoint.
+func (a *ClientCredentialsAuth) fetchToken(ctx context.Context) (clientCredentialsToken, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(a.Scopes) > 0 {
+		form.Set("scope", strings.Join(a.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return clientCredentialsToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(a.ClientID), url.QueryEscape(a.ClientSecret))
+
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return clientCredentialsToken{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := readErrorBody(resp.Body)
+		return clientCredentialsToken{}, newAPIError(resp, body)
+	}
+
+	token := clientCredentialsToken{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return clientCredentialsToken{}, err
+	}
+	if token.AccessToken == "" {
+		return clientCredentialsToken{}, fmt.Errorf("token endpoint %s returned no access_token", a.TokenURL)
+	}
+
+	return token, nil
+}
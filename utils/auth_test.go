@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAuthenticatorsSetCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"authorization": r.Header.Get("Authorization"),
+			"apiKey":        r.Header.Get("X-API-Key"),
+			"queryKey":      r.URL.Query().Get("api_key"),
+			"user":          user,
+			"pass":          pass,
+		})
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name  string
+		auth  Authenticator
+		field string
+		want  string
+	}{
+		{"bearer", BearerAuth{Token: "secret"}, "authorization", "Bearer secret"},
+		{"basic", BasicAuth{Username: "me", Password: "pw"}, "pass", "pw"},
+		{"header", HeaderKeyAuth{Header: "X-API-Key", Key: "k1"}, "apiKey", "k1"},
+		{"query", QueryKeyAuth{Param: "api_key", Key: "k2"}, "queryKey", "k2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiClient := NewAPIClientWithAuth(server.URL, tt.auth)
+			resp, err := Get[map[string]string](context.Background(), &apiClient, "/whoami?x=1")
+			if err != nil {
+				t.Fatalf("Error making authenticated request: %v", err)
+			}
+			if resp[tt.field] != tt.want {
+				t.Errorf("Expected %s to be %q, got %q", tt.field, tt.want, resp[tt.field])
+			}
+		})
+	}
+}
+
+func TestTokenFieldFallsBackToBearer(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "legacy")
+	resp := map[string]interface{}{}
+	if err := apiClient.Get("/", &resp); err != nil {
+		t.Fatalf("Error making GET request: %v", err)
+	}
+	if got != "Bearer legacy" {
+		t.Errorf("Expected Bearer legacy, got %q", got)
+	}
+}
+
+func TestClientCredentialsAuthCachesAndRefreshes(t *testing.T) {
+	var issued atomic.Int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "client_credentials" || id != "client" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := issued.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "token-" + string(rune('0'+n)),
+			"token_type":   "bearer",
+			"expires_in":   3600,
+		})
+	}))
+	defer tokenServer.Close()
+
+	var seen []string
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer apiServer.Close()
+
+	auth := NewClientCredentialsAuth(tokenServer.URL, "client", "s3cret", "read")
+	apiClient := NewAPIClientWithAuth(apiServer.URL, auth)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := Get[map[string]interface{}](ctx, &apiClient, "/"); err != nil {
+			t.Fatalf("Error making request: %v", err)
+		}
+	}
+	if issued.Load() != 1 {
+		t.Errorf("Expected the token to be fetched once and cached, fetched %d times", issued.Load())
+	}
+
+	auth.Invalidate()
+	if _, err := Get[map[string]interface{}](ctx, &apiClient, "/"); err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	if issued.Load() != 2 {
+		t.Errorf("Expected a new token after Invalidate, fetched %d times", issued.Load())
+	}
+
+	want := []string{"Bearer token-1", "Bearer token-1", "Bearer token-2"}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Errorf("Request %d: expected %q, got %q", i, want[i], seen[i])
+		}
+	}
+}
+
+func TestClientCredentialsAuthRejected(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer tokenServer.Close()
+
+	auth := NewClientCredentialsAuth(tokenServer.URL, "client", "wrong")
+	_, err := auth.Token(context.Background())
+	if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected APIError with status 401, got %v", err)
+	}
+}
+
+func TestClientCredentialsAuthShortLivedAndSharedFetch(t *testing.T) {
+	var issued atomic.Int32
+	var once sync.Once
+	requested, release := make(chan struct{}), make(chan struct{})
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { close(requested) })
+		<-release
+		issued.Add(1)
+		// Shorter than the default ExpiryDelta of 30 seconds.
+		_, _ = w.Write([]byte(`{"access_token": "short", "expires_in": 10}`))
+	}))
+	defer tokenServer.Close()
+
+	auth := NewClientCredentialsAuth(tokenServer.URL, "client", "s3cret")
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := auth.Token(first)
+		firstErr <- err
+	}()
+	<-requested
+	cancel()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the cancelled caller to give up, got %v", err)
+	}
+
+	second := make(chan string, 1)
+	go func() {
+		token, _ := auth.Token(context.Background())
+		second <- token
+	}()
+	close(release)
+	if token := <-second; token != "short" {
+		t.Errorf("Expected the fetch started by the cancelled caller to serve the next one, got %q", token)
+	}
+
+	if token, err := auth.Token(context.Background()); token != "short" || err != nil || issued.Load() != 1 {
+		t.Errorf("Expected a short-lived token to be cached, got %q, %v after %d fetches", token, err, issued.Load())
+	}
+}
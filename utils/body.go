@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+// RequestBody is a request that encodes itself instead of being sent as JSON, e.g. a form or a file upload.
+type RequestBody interface {
+	// Encode returns the body and its Content-Type. Bodies returned as *strings.Reader, *bytes.Reader or
+	// *bytes.Buffer can be sent again when a request is retried, streamed bodies cannot.
+	Encode() (io.Reader, string, error)
+}
+
+// FormBody is an application/x-www-form-urlencoded request body.
+type FormBody url.Values
+
+// Encode returns the URL encoded form.
+func (f FormBody) Encode() (io.Reader, string, error) {
+	return strings.NewReader(url.Values(f).Encode()), "application/x-www-form-urlencoded", nil
+}
+
+// MultipartFile is a file part of a MultipartBody, its Content is streamed and never buffered entirely in memory.
+type MultipartFile struct {
+	FieldName string
+	FileName  string
+	// ContentType defaults to application/octet-stream.
+	ContentType string
+	Content     io.Reader
+}
+
+// MultipartBody is a multipart/form-data request body made of plain fields followed by files.
+// The files are read while the request is sent, so the body can only be sent once and is never retried.
+type MultipartBody struct {
+	Fields url.Values
+	Files  []MultipartFile
+}
+
+// Encode returns a reader streaming the multipart body as it is read.
+func (m MultipartBody) Encode() (io.Reader, string, error) {
+	reader, writer := io.Pipe()
+	mw := multipart.NewWriter(writer)
+
+	go func() {
+		// Closing with the error (nil on success) ends the stream, or fails the read on the sending side.
+		writer.CloseWithError(m.write(mw))
+	}()
+
+	return reader, mw.FormDataContentType(), nil
+}
+
+// write writes every field and file to mw and closes it.
+func (m MultipartBody) write(mw *multipart.Writer) error {
+	for name, values := range m.Fields {
+		for _, value := range values {
+			if err := mw.WriteField(name, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, file := range m.Files {
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(file.FieldName), escapeQuotes(file.FileName)))
+		header.Set("Content-Type", contentType)
+
+		part, err := mw.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, file.Content); err != nil {
+			return err
+		}
+	}
+
+	return mw.Close()
+}
+
+// quoteEscaper escapes the characters that would end a quoted Content-Disposition parameter, as mime/multipart does.
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
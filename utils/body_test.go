@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMultipartBodyUpload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		parts := map[string]string{}
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			content, _ := io.ReadAll(part)
+			key := part.FormName()
+			if part.FileName() != "" {
+				key += ":" + part.FileName() + ":" + part.Header.Get("Content-Type")
+			}
+			parts[key] = string(content)
+		}
+		_ = json.NewEncoder(w).Encode(parts)
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "")
+	body := MultipartBody{
+		Fields: url.Values{"comment": {"nightly backup"}},
+		Files: []MultipartFile{
+			{FieldName: "files", FileName: "backup.tar", Content: strings.NewReader(strings.Repeat("x", 1<<16))},
+			{FieldName: "files", FileName: "notes.txt", ContentType: "text/plain", Content: strings.NewReader("hello")},
+		},
+	}
+
+	parts, err := Put[map[string]string](context.Background(), &apiClient, "/upload", body)
+	if err != nil {
+		t.Fatalf("Error uploading: %v", err)
+	}
+	if parts["comment"] != "nightly backup" {
+		t.Errorf("Expected comment field, got %v", parts)
+	}
+	if len(parts["files:backup.tar:application/octet-stream"]) != 1<<16 {
+		t.Errorf("Expected backup.tar with its full content, got keys %v", slices.Sorted(maps.Keys(parts)))
+	}
+	if parts["files:notes.txt:text/plain"] != "hello" {
+		t.Errorf("Expected notes.txt part, got keys %v", slices.Sorted(maps.Keys(parts)))
+	}
+}
+
+func TestFormBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+			http.Error(w, "not a form", http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"name": r.PostForm.Get("name"), "tags": strings.Join(r.PostForm["tag"], ",")})
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "")
+	got, err := Post[map[string]string](context.Background(), &apiClient, "/form", FormBody{"name": {"a & b"}, "tag": {"x", "y"}})
+	if err != nil {
+		t.Fatalf("Error posting form: %v", err)
+	}
+	if got["name"] != "a & b" || got["tags"] != "x,y" {
+		t.Errorf("Unexpected form seen by server %v", got)
+	}
+}
+
+func TestMultipartBodyClosedOnInvalidURL(t *testing.T) {
+	before := runtime.NumGoroutine()
+	apiClient := NewAPIClient("http://[::1", "")
+	body := MultipartBody{Fields: url.Values{"comment": {"nightly backup"}}}
+	if _, err := Put[map[string]string](context.Background(), &apiClient, "/upload", body); err == nil {
+		t.Fatalf("Expected an invalid URL to fail")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if runtime.NumGoroutine() > before {
+		t.Errorf("Expected the multipart writer to stop, %d goroutines left over", runtime.NumGoroutine()-before)
+	}
+}
@@ -0,0 +1,227 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets every request through while counting failures.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects every request with ErrCircuitOpen until the cool-down has passed.
+	CircuitOpen
+	// CircuitHalfOpen lets a few probe requests through to find out whether the upstream recovered.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// ErrCircuitOpen is returned, wrapped in a CircuitOpenError, for requests rejected by an open circuit breaker.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitOpenError is the error returned for requests rejected by an open circuit breaker.
+type CircuitOpenError struct {
+	Name string
+	// RetryAt is when the breaker lets probe requests through again.
+	RetryAt time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return "circuit breaker " + e.Name + " is open until " + e.RetryAt.Format(time.RFC3339)
+}
+
+// Is makes errors.Is(err, ErrCircuitOpen) match a CircuitOpenError.
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// CircuitBreaker stops sending requests to an upstream that keeps failing, so callers fail fast instead of
+// piling up on timeouts. Network errors, 429 and 5xx responses count as failures. It is safe for concurrent use.
+type CircuitBreaker struct {
+	Name string
+	// FailureRatio is the ratio of failed requests within Window that opens the circuit.
+	FailureRatio float64
+	// MinRequests is the number of requests within Window needed before FailureRatio is considered.
+	MinRequests int
+	// Window is how long failures are counted for before the counts start over.
+	Window time.Duration
+	// CoolDown is how long the circuit stays open before letting probe requests through.
+	CoolDown time.Duration
+	// HalfOpenRequests is the number of probe requests that must succeed to close the circuit again.
+	HalfOpenRequests int
+	// OnStateChange is called, without the breaker's lock held, whenever the state changes.
+	OnStateChange func(name string, from, to CircuitState)
+
+	mu               sync.Mutex
+	state            CircuitState
+	requests         int
+	failures         int
+	windowStart      time.Time
+	openedAt         time.Time
+	halfOpenInFlight int
+	halfOpenSuccess  int
+	// generation counts state changes, so outcomes of requests let through in an earlier state are ignored.
+	generation uint64
+}
+
+// NewCircuitBreaker creates a CircuitBreaker opening when half of at least 5 requests within a minute fail,
+// and probing the upstream again after 30 seconds.
+func NewCircuitBreaker(name string) *CircuitBreaker {
+	return &CircuitBreaker{
+		Name:             name,
+		FailureRatio:     0.5,
+		MinRequests:      5,
+		Window:           time.Minute,
+		CoolDown:         30 * time.Second,
+		HalfOpenRequests: 1,
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.CoolDown {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// allow reports whether a request made with ctx may be sent, the returned function must be called with its outcome.
+func (b *CircuitBreaker) allow(ctx context.Context) (func(resp *http.Response, err error), error) {
+	if b == nil {
+		return func(*http.Response, error) {}, nil
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	from := b.state
+
+	switch b.state {
+	case CircuitClosed:
+		if now.Sub(b.windowStart) >= b.Window {
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+	case CircuitOpen:
+		if now.Sub(b.openedAt) < b.CoolDown {
+			retryAt := b.openedAt.Add(b.CoolDown)
+			b.mu.Unlock()
+			return nil, &CircuitOpenError{Name: b.Name, RetryAt: retryAt}
+		}
+		b.setState(CircuitHalfOpen)
+	}
+
+	if b.state == CircuitHalfOpen {
+		if b.halfOpenInFlight >= max(b.HalfOpenRequests, 1) {
+			to := b.state
+			b.mu.Unlock()
+			b.notify(from, to)
+			return nil, &CircuitOpenError{Name: b.Name, RetryAt: now}
+		}
+		b.halfOpenInFlight++
+	}
+
+	to, generation := b.state, b.generation
+	b.mu.Unlock()
+	b.notify(from, to)
+
+	return func(resp *http.Response, err error) {
+		if err != nil && ctx.Err() != nil {
+			// Cancellation is the caller giving up, it says nothing about the upstream.
+			b.record(generation, false, true)
+			return
+		}
+		if errors.Is(err, ErrResponseTooLarge) {
+			// An oversized response is an answer from a working upstream.
+			b.record(generation, false, false)
+			return
+		}
+		b.record(generation, err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, false)
+	}, nil
+}
+
+// record counts the outcome of a request let through by allow in the given generation, an abandoned request only
+// frees its probe slot.
+func (b *CircuitBreaker) record(generation uint64, failed, abandoned bool) {
+	b.mu.Lock()
+	if generation != b.generation {
+		// The request was let through before the state last changed, e.g. a slow one sent while closed finishing
+		// after the circuit opened and went half-open, it is no probe and says nothing about the current state.
+		b.mu.Unlock()
+		return
+	}
+	from := b.state
+
+	switch {
+	case abandoned:
+		if b.state == CircuitHalfOpen && b.halfOpenInFlight > 0 {
+			b.halfOpenInFlight--
+		}
+	case b.state == CircuitClosed:
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= b.MinRequests && float64(b.failures) >= b.FailureRatio*float64(b.requests) {
+			b.setState(CircuitOpen)
+		}
+	case b.state == CircuitHalfOpen:
+		b.halfOpenInFlight = max(b.halfOpenInFlight-1, 0)
+		if failed {
+			b.setState(CircuitOpen)
+			break
+		}
+		b.halfOpenSuccess++
+		if b.halfOpenSuccess >= max(b.HalfOpenRequests, 1) {
+			b.setState(CircuitClosed)
+		}
+	}
+
+	to := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+}
+
+// setState switches to state and resets the counters belonging to it, b.mu must be held.
+func (b *CircuitBreaker) setState(state CircuitState) {
+	b.state = state
+	b.generation++
+	switch state {
+	case CircuitClosed:
+		b.windowStart, b.requests, b.failures = time.Now(), 0, 0
+	case CircuitOpen:
+		b.openedAt = time.Now()
+	case CircuitHalfOpen:
+		b.halfOpenInFlight, b.halfOpenSuccess = 0, 0
+	}
+}
+
+// notify logs and reports a state change, if there was one. It must be called without b.mu held.
+func (b *CircuitBreaker) notify(from, to CircuitState) {
+	if from == to {
+		return
+	}
+
+	slog.Default().Warn("Circuit breaker changed state", "name", b.Name, "from", from.String(), "to", to.String())
+	if b.OnStateChange != nil {
+		b.OnStateChange(b.Name, from, to)
+	}
+}
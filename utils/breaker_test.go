@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	var healthy atomic.Bool
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	var transitions []string
+	breaker := NewCircuitBreaker("test")
+	breaker.MinRequests = 3
+	breaker.CoolDown = 20 * time.Millisecond
+	breaker.OnStateChange = func(name string, from, to CircuitState) {
+		transitions = append(transitions, from.String()+"->"+to.String())
+	}
+
+	apiClient := NewAPIClient(server.URL, "", WithBreaker(breaker))
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := Get[map[string]interface{}](ctx, &apiClient, "/"); !IsRetryable(err) {
+			t.Fatalf("Expected a 502 APIError, got %v", err)
+		}
+	}
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("Expected breaker to be open, got %s", breaker.State())
+	}
+
+	_, err := Get[map[string]interface{}](ctx, &apiClient, "/")
+	var openErr *CircuitOpenError
+	if !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &openErr) || calls.Load() != 3 {
+		t.Fatalf("Expected ErrCircuitOpen without reaching the server, got %v after %d calls", err, calls.Load())
+	}
+
+	healthy.Store(true)
+	time.Sleep(30 * time.Millisecond)
+	if _, err := Get[map[string]interface{}](ctx, &apiClient, "/"); err != nil {
+		t.Fatalf("Expected the probe request to succeed, got %v", err)
+	}
+	if breaker.State() != CircuitClosed {
+		t.Errorf("Expected breaker to close after a successful probe, got %s", breaker.State())
+	}
+
+	expected := []string{"closed->open", "open->half-open", "half-open->closed"}
+	if len(transitions) != len(expected) {
+		t.Fatalf("Expected transitions %v, got %v", expected, transitions)
+	}
+	for i := range expected {
+		if transitions[i] != expected[i] {
+			t.Errorf("Expected transitions %v, got %v", expected, transitions)
+			break
+		}
+	}
+}
+
+func TestCircuitBreakerReopensOnFailedProbe(t *testing.T) {
+	breaker := NewCircuitBreaker("probe")
+	breaker.MinRequests = 1
+	breaker.CoolDown = time.Millisecond
+
+	done, _ := breaker.allow(context.Background())
+	done(nil, errors.New("connection refused"))
+	time.Sleep(2 * time.Millisecond)
+
+	done, err := breaker.allow(context.Background())
+	if err != nil {
+		t.Fatalf("Expected a probe to be allowed, got %v", err)
+	}
+	if _, err := breaker.allow(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected only one probe at a time, got %v", err)
+	}
+	breaker.CoolDown = time.Hour
+	done(&http.Response{StatusCode: http.StatusServiceUnavailable}, nil)
+	if breaker.State() != CircuitOpen {
+		t.Errorf("Expected a failed probe to reopen the breaker, got %s", breaker.State())
+	}
+}
+
+func TestCircuitBreakerIgnoresCacheHits(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	breaker := NewCircuitBreaker("test")
+	breaker.MinRequests = 2
+	apiClient := NewAPIClient(server.URL, "", WithBreaker(breaker), WithCache(NewResponseCache(10, time.Hour)))
+	ctx := context.Background()
+
+	if _, err := Get[map[string]interface{}](ctx, &apiClient, "/cached"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	healthy.Store(false)
+	for i := 0; i < 2; i++ {
+		_, _ = Get[map[string]interface{}](ctx, &apiClient, "/cached")
+		_, _ = Get[map[string]interface{}](ctx, &apiClient, "/uncached")
+	}
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("Expected cache hits not to dilute the failures, got %s", breaker.State())
+	}
+
+	if _, err := Get[map[string]interface{}](ctx, &apiClient, "/cached"); err != nil {
+		t.Errorf("Expected a cached response while the breaker is open, got %v", err)
+	}
+	if _, err := Get[map[string]interface{}](ctx, &apiClient, "/uncached"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected ErrCircuitOpen for a request reaching the server, got %v", err)
+	}
+}
+
+func TestCircuitBreakerIgnoresOutcomesFromEarlierStates(t *testing.T) {
+	breaker := NewCircuitBreaker("test")
+	breaker.MinRequests = 2
+	breaker.CoolDown = 10 * time.Millisecond
+	ctx := context.Background()
+	ok := &http.Response{StatusCode: http.StatusOK}
+
+	slowDone, err := breaker.allow(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		done, _ := breaker.allow(ctx)
+		done(nil, errors.New("connection refused"))
+	}
+	time.Sleep(20 * time.Millisecond)
+	probeDone, err := breaker.allow(ctx)
+	if err != nil {
+		t.Fatalf("Expected a probe to be let through, got %v", err)
+	}
+
+	// The slow request was sent while closed, its success is no probe.
+	slowDone(ok, nil)
+	if breaker.State() != CircuitHalfOpen {
+		t.Fatalf("Expected the breaker to stay half-open, got %s", breaker.State())
+	}
+	if _, err := breaker.allow(ctx); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected the probe slot to still be taken, got %v", err)
+	}
+
+	probeDone(ok, nil)
+	if breaker.State() != CircuitClosed {
+		t.Errorf("Expected the probe to close the breaker, got %s", breaker.State())
+	}
+}
@@ -0,0 +1,365 @@
+package utils
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachedResponse is a successful GET response stored by a ResponseCache.
+type CachedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	// ExpiresAt is when the response stops being served without asking the server first.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CacheStore stores cached responses by key, implementations must be safe for concurrent use.
+type CacheStore interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, entry *CachedResponse)
+	Delete(key string)
+	// DeleteMatching removes every entry whose key match reports true for.
+	DeleteMatching(match func(key string) bool)
+	Clear()
+}
+
+// ResponseCache caches successful GET responses of an AuthenticatedAPIClient for TTL. Once an entry expires,
+// it is revalidated with If-None-Match/If-Modified-Since when the server sent an ETag or Last-Modified,
+// so an unchanged resource costs a 304 instead of a full response.
+//
+// Entries are keyed by URL only, a cache must not be shared between clients using different credentials.
+type ResponseCache struct {
+	Store CacheStore
+	TTL   time.Duration
+	// Invalidates returns the URLs whose cached responses are dropped after a successful POST, PUT, PATCH or DELETE request.
+	// When nil, every cached response for the request's path is dropped whatever its query string, e.g. every page of
+	// /projects/1/tasks after a PUT to /projects/1/tasks. When set, only the exact URLs returned are dropped.
+	Invalidates func(req *http.Request) []string
+}
+
+// NewResponseCache creates a ResponseCache keeping up to size responses in memory for ttl.
+func NewResponseCache(size int, ttl time.Duration) *ResponseCache {
+	return &ResponseCache{Store: NewMemoryCacheStore(size), TTL: ttl}
+}
+
+// Invalidate drops the cached response for rawURL, e.g. the result of c.URL(endpoint).
+func (rc *ResponseCache) Invalidate(rawURL string) {
+	rc.Store.Delete(rawURL)
+}
+
+// Clear drops every cached response.
+func (rc *ResponseCache) Clear() {
+	rc.Store.Clear()
+}
+
+// send answers GET requests from the cache where possible and sends everything else using next,
+// invalidating cached responses after successful requests with unsafe methods.
+func (rc *ResponseCache) send(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	if rc == nil {
+		return next(req)
+	}
+	if !isSafeMethod(req.Method) {
+		return rc.sendMutation(req, next)
+	}
+	if req.Method != http.MethodGet {
+		return next(req)
+	}
+
+	key := req.URL.String()
+	entry, ok := rc.Store.Get(key)
+	if ok && time.Now().Before(entry.ExpiresAt) {
+		return entry.response(req), nil
+	}
+
+	if ok {
+		etag, lastModified := entry.Header.Get("ETag"), entry.Header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			req = req.Clone(req.Context())
+			if etag != "" {
+				req.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" {
+				req.Header.Set("If-Modified-Since", lastModified)
+			}
+		}
+	}
+
+	resp, err := next(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok && resp.StatusCode == http.StatusNotModified {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		entry.ExpiresAt = time.Now().Add(rc.TTL)
+		rc.Store.Set(key, entry)
+		return entry.response(req), nil
+	}
+
+	if resp.StatusCode != http.StatusOK || strings.Contains(resp.Header.Get("Cache-Control"), "no-store") {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	rc.Store.Set(key, &CachedResponse{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+		ExpiresAt:  time.Now().Add(rc.TTL),
+	})
+
+	return resp, nil
+}
+
+// sendMutation sends a request with an unsafe method and drops the cached responses it invalidates once it succeeded.
+func (rc *ResponseCache) sendMutation(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	resp, err := next(req)
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp, err
+	}
+
+	if rc.Invalidates == nil {
+		rc.Store.DeleteMatching(samePath(req.URL))
+		return resp, nil
+	}
+	for _, key := range rc.Invalidates(req) {
+		rc.Store.Delete(key)
+	}
+
+	return resp, nil
+}
+
+// samePath returns a match for the cache keys, i.e. URLs, of u's path with any query string.
+func samePath(u *url.URL) func(key string) bool {
+	base := *u
+	base.RawQuery, base.ForceQuery, base.Fragment = "", false, ""
+	path := base.String()
+	return func(key string) bool {
+		keyPath, _, _ := strings.Cut(key, "?")
+		return keyPath == path
+	}
+}
+
+// response builds an http.Response for req out of the cached entry.
+func (e *CachedResponse) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// MemoryCacheStore is an in-memory CacheStore evicting the least recently used entry once it is full.
+type MemoryCacheStore struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// memoryCacheItem is the value stored in MemoryCacheStore's recency list.
+type memoryCacheItem struct {
+	key   string
+	entry *CachedResponse
+}
+
+// NewMemoryCacheStore creates a MemoryCacheStore holding at most size entries, a size below 1 means 1.
+func NewMemoryCacheStore(size int) *MemoryCacheStore {
+	return &MemoryCacheStore{
+		size:    max(size, 1),
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// Get returns the entry for key and marks it as recently used.
+func (s *MemoryCacheStore) Get(key string) (*CachedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	s.order.MoveToFront(element)
+	entry := *element.Value.(*memoryCacheItem).entry
+	return &entry, true
+}
+
+// Set stores entry under key, evicting the least recently used entry if the store is full.
+func (s *MemoryCacheStore) Set(key string, entry *CachedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[key]; ok {
+		element.Value.(*memoryCacheItem).entry = entry
+		s.order.MoveToFront(element)
+		return
+	}
+
+	s.entries[key] = s.order.PushFront(&memoryCacheItem{key: key, entry: entry})
+	if s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryCacheItem).key)
+	}
+}
+
+// Delete removes the entry for key.
+func (s *MemoryCacheStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[key]; ok {
+		s.order.Remove(element)
+		delete(s.entries, key)
+	}
+}
+
+// DeleteMatching removes every entry whose key match reports true for.
+func (s *MemoryCacheStore) DeleteMatching(match func(key string) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, element := range s.entries {
+		if match(key) {
+			s.order.Remove(element)
+			delete(s.entries, key)
+		}
+	}
+}
+
+// Clear removes every entry.
+func (s *MemoryCacheStore) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.order.Init()
+	s.entries = map[string]*list.Element{}
+}
+
+// DiskCacheStore is a CacheStore keeping one JSON file per entry in Dir, so the cache outlives short-lived CLIs.
+type DiskCacheStore struct {
+	Dir string
+}
+
+// diskCacheEntry is the content of a DiskCacheStore file, the key is kept for DeleteMatching as file names are hashes.
+type diskCacheEntry struct {
+	Key string `json:"key"`
+	*CachedResponse
+}
+
+// path returns the file the entry for key is stored in.
+func (s DiskCacheStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Get reads the entry for key, unreadable entries are treated as missing.
+func (s DiskCacheStore) Get(key string) (*CachedResponse, bool) {
+	data, err := os.ReadFile(s.path(key))
+	if err != nil {
+		return nil, false
+	}
+	entry := diskCacheEntry{CachedResponse: &CachedResponse{}}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	return entry.CachedResponse, true
+}
+
+// Set writes the entry for key, failures are logged as the cache is best-effort.
+func (s DiskCacheStore) Set(key string, entry *CachedResponse) {
+	data, err := json.Marshal(diskCacheEntry{Key: key, CachedResponse: entry})
+	if err == nil {
+		err = os.MkdirAll(s.Dir, 0o700)
+	}
+	if err == nil {
+		err = s.write(key, data)
+	}
+	if err != nil {
+		slog.Default().Warn("Failed to write cache entry", "dir", s.Dir, "error", err)
+	}
+}
+
+// write replaces the file for key with data through a temporary file of its own, so concurrent readers never see a
+// partial entry and concurrent writers of the same key never write into one another's file.
+func (s DiskCacheStore) write(key string, data []byte) error {
+	tmp, err := os.CreateTemp(s.Dir, "entry-*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path(key))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Delete removes the entry for key.
+func (s DiskCacheStore) Delete(key string) {
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Default().Warn("Failed to delete cache entry", "dir", s.Dir, "error", err)
+	}
+}
+
+// DeleteMatching removes every entry in Dir whose key match reports true for, reading each entry's key from its file.
+func (s DiskCacheStore) DeleteMatching(match func(key string) bool) {
+	files, _ := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		entry := struct {
+			Key string `json:"key"`
+		}{}
+		if json.Unmarshal(data, &entry) == nil && match(entry.Key) {
+			_ = os.Remove(file)
+		}
+	}
+}
+
+// Clear removes every entry in Dir.
+func (s DiskCacheStore) Clear() {
+	files, _ := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+	for _, file := range files {
+		_ = os.Remove(file)
+	}
+}
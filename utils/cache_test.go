@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// etagServer serves a versioned resource with an ETag, answering matching conditional requests with 304.
+func etagServer(version *atomic.Int32, full, notModified *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			version.Add(1)
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		etag := `"v` + string(rune('0'+version.Load())) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(`{"etag": ` + etag + `}`))
+	}))
+}
+
+func TestResponseCacheServesFreshEntries(t *testing.T) {
+	var version, full, notModified atomic.Int32
+	server := etagServer(&version, &full, &notModified)
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "", WithCache(NewResponseCache(10, time.Hour)))
+	for i := 0; i < 3; i++ {
+		got, err := Get[map[string]string](context.Background(), &apiClient, "/labels")
+		if err != nil || got["etag"] != "v0" {
+			t.Fatalf("Unexpected response %v, %v", got, err)
+		}
+	}
+	if full.Load() != 1 || notModified.Load() != 0 {
+		t.Errorf("Expected a single request, got %d full and %d conditional", full.Load(), notModified.Load())
+	}
+
+	// A successful mutation of the same URL drops the cached response.
+	if _, err := Post[map[string]string](context.Background(), &apiClient, "/labels", map[string]string{}); err != nil {
+		t.Fatalf("Error making POST request: %v", err)
+	}
+	got, _ := Get[map[string]string](context.Background(), &apiClient, "/labels")
+	if got["etag"] != "v1" || full.Load() != 2 {
+		t.Errorf("Expected the mutation to invalidate the cache, got %v after %d requests", got, full.Load())
+	}
+}
+
+func TestResponseCacheRevalidatesExpiredEntries(t *testing.T) {
+	var version, full, notModified atomic.Int32
+	server := etagServer(&version, &full, &notModified)
+	defer server.Close()
+
+	cache := &ResponseCache{Store: DiskCacheStore{Dir: t.TempDir()}, TTL: -time.Second}
+	apiClient := NewAPIClient(server.URL, "", WithCache(cache))
+	for i := 0; i < 3; i++ {
+		got, err := Get[map[string]string](context.Background(), &apiClient, "/projects")
+		if err != nil || got["etag"] != "v0" {
+			t.Fatalf("Unexpected response %v, %v", got, err)
+		}
+	}
+	if full.Load() != 1 || notModified.Load() != 2 {
+		t.Errorf("Expected 1 full and 2 conditional requests, got %d and %d", full.Load(), notModified.Load())
+	}
+
+	cache.Invalidate(apiClient.URL("/projects"))
+	_, _ = Get[map[string]string](context.Background(), &apiClient, "/projects")
+	if full.Load() != 2 {
+		t.Errorf("Expected Invalidate to force a full request, got %d", full.Load())
+	}
+}
+
+func TestMemoryCacheStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	store := NewMemoryCacheStore(2)
+	store.Set("a", &CachedResponse{})
+	store.Set("b", &CachedResponse{})
+	store.Get("a")
+	store.Set("c", &CachedResponse{})
+
+	if _, ok := store.Get("b"); ok {
+		t.Errorf("Expected b to be evicted")
+	}
+	if _, ok := store.Get("a"); !ok {
+		t.Errorf("Expected a to be kept as it was used recently")
+	}
+}
+
+func TestDiskCacheStoreConcurrentSets(t *testing.T) {
+	logs := &bytes.Buffer{}
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(logs, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	store := DiskCacheStore{Dir: t.TempDir()}
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.Set("tasks", &CachedResponse{StatusCode: http.StatusOK, Body: []byte(strconv.Itoa(i))})
+		}()
+	}
+	wg.Wait()
+
+	if logs.Len() != 0 {
+		t.Errorf("Expected concurrent writes not to fail, got %s", logs)
+	}
+	if _, ok := store.Get("tasks"); !ok {
+		t.Errorf("Expected one of the concurrent writes to be stored")
+	}
+	files, _ := os.ReadDir(store.Dir)
+	if len(files) != 1 {
+		t.Errorf("Expected only the entry to be left behind, got %d files", len(files))
+	}
+}
+
+func TestResponseCacheInvalidatesEveryQueryOfPath(t *testing.T) {
+	var mu sync.Mutex
+	fetched := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			mu.Lock()
+			fetched[r.URL.RequestURI()]++
+			mu.Unlock()
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	for _, store := range []CacheStore{NewMemoryCacheStore(10), DiskCacheStore{Dir: t.TempDir()}} {
+		clear(fetched)
+		apiClient := NewAPIClient(server.URL, "", WithCache(&ResponseCache{Store: store, TTL: time.Hour}))
+		ctx := context.Background()
+		paths := []string{"/projects/1/tasks?page=1", "/projects/1/tasks?page=2", "/projects/1/tasks", "/projects/1"}
+		for range 2 {
+			for _, path := range paths {
+				_, _ = Get[map[string]string](ctx, &apiClient, path)
+			}
+		}
+		if _, err := Put[map[string]string](ctx, &apiClient, "/projects/1/tasks", map[string]string{"title": "new"}); err != nil {
+			t.Fatalf("Error making PUT request: %v", err)
+		}
+		for _, path := range paths {
+			_, _ = Get[map[string]string](ctx, &apiClient, path)
+		}
+
+		expected := map[string]int{"/projects/1/tasks?page=1": 2, "/projects/1/tasks?page=2": 2, "/projects/1/tasks": 2, "/projects/1": 1}
+		for path, count := range expected {
+			if fetched[path] != count {
+				t.Errorf("%T: expected %s to be fetched %d times, got %d", store, path, count, fetched[path])
+			}
+		}
+	}
+}
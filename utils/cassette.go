@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// CassetteMode selects whether a Cassette replays recorded interactions or records new ones.
+type CassetteMode int
+
+const (
+	// CassetteReplay answers requests from the recorded interactions and never touches the network.
+	CassetteReplay CassetteMode = iota
+	// CassetteRecord sends requests to the real server and records them, Save writes them to disk.
+	CassetteRecord
+)
+
+// Interaction is a recorded request and the response it received.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the scrubbed form of a request stored in a cassette.
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// RecordedResponse is the scrubbed form of a response stored in a cassette.
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body"`
+}
+
+// Cassette records HTTP interactions to a JSON file and replays them, so tests can run without network access.
+// Credentials are scrubbed before anything is stored: sensitive headers are dropped, sensitive query parameters
+// redacted and every string in Secrets is replaced wherever it appears.
+type Cassette struct {
+	Path         string
+	Mode         CassetteMode
+	Secrets      []string
+	Interactions []Interaction
+
+	mu   sync.Mutex
+	used []bool
+}
+
+// LoadCassette opens the cassette at path. In replay mode the file must exist, in record mode it is started empty.
+func LoadCassette(path string, mode CassetteMode) (*Cassette, error) {
+	c := &Cassette{Path: path, Mode: mode}
+	if mode == CassetteRecord {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c.Interactions); err != nil {
+		return nil, fmt.Errorf("cassette %s: %w", path, err)
+	}
+	c.used = make([]bool, len(c.Interactions))
+
+	return c, nil
+}
+
+// Save writes the recorded interactions to the cassette's path, it does nothing in replay mode.
+func (c *Cassette) Save() error {
+	if c.Mode != CassetteRecord {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := json.MarshalIndent(c.Interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(c.Path, append(data, '\n'), 0o644)
+}
+
+// Middleware returns a Middleware that replays or records requests according to the cassette's mode.
+func (c *Cassette) Middleware() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if c.Mode == CassetteRecord {
+				return c.record(next, req)
+			}
+			return c.replay(req)
+		})
+	}
+}
+
+// record sends req using next and stores the scrubbed interaction.
+func (c *Cassette) record(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	reqBody, err := readAndRestore(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := readAndRestore(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Interactions = append(c.Interactions, Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    c.scrub(redactURL(req.URL)),
+			Header: c.scrubHeader(req.Header),
+			Body:   c.scrub(string(reqBody)),
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     c.scrubHeader(resp.Header),
+			Body:       c.scrub(string(respBody)),
+		},
+	})
+
+	return resp, nil
+}
+
+// replay answers req with the first unused recorded interaction matching its method, path, query and body.
+// Once all matching interactions have been used the last one is replayed again.
+func (c *Cassette) replay(req *http.Request) (*http.Response, error) {
+	reqBody, err := readAndRestore(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	target := c.scrub(requestURI(redactURL(req.URL)))
+	body := c.scrub(string(reqBody))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	match := -1
+	for i, interaction := range c.Interactions {
+		recorded := interaction.Request
+		if recorded.Method != req.Method || requestURI(recorded.URL) != target || recorded.Body != body {
+			continue
+		}
+		match = i
+		if !c.used[i] {
+			break
+		}
+	}
+	if match < 0 {
+		return nil, fmt.Errorf("cassette %s has no interaction for %s %s", c.Path, req.Method, target)
+	}
+	c.used[match] = true
+
+	recorded := c.Interactions[match].Response
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Header.Clone(),
+		Body:          io.NopCloser(strings.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}, nil
+}
+
+// scrub replaces every configured secret in s.
+func (c *Cassette) scrub(s string) string {
+	for _, secret := range c.Secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, "xxxxx")
+		}
+	}
+	return s
+}
+
+// scrubHeader returns a copy of header without sensitive headers and with secrets replaced.
+func (c *Cassette) scrubHeader(header http.Header) http.Header {
+	scrubbed := http.Header{}
+	for name, values := range header {
+		if ArrContains(sensitiveHeaders, http.CanonicalHeaderKey(name)) {
+			continue
+		}
+		for _, value := range values {
+			scrubbed.Add(name, c.scrub(value))
+		}
+	}
+	return scrubbed
+}
+
+// requestURI strips the scheme and host from rawURL, so recordings replay against servers on other addresses.
+func requestURI(rawURL string) string {
+	if i := strings.Index(rawURL, "://"); i >= 0 {
+		rawURL = rawURL[i+3:]
+		if j := strings.IndexAny(rawURL, "/?"); j >= 0 {
+			return rawURL[j:]
+		}
+		return "/"
+	}
+	return rawURL
+}
+
+// readAndRestore reads *body fully and replaces it with a reader over the same bytes.
+func readAndRestore(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	data, err := io.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"path": "` + r.URL.Path + `", "token": "` + r.Header.Get("Authorization") + `"}`))
+	}))
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	recorder, err := LoadCassette(path, CassetteRecord)
+	if err != nil {
+		t.Fatalf("Error creating cassette: %v", err)
+	}
+	recorder.Secrets = []string{"s3cret-token"}
+
+	apiClient := NewAPIClient(server.URL, "s3cret-token", WithMiddleware(recorder.Middleware()))
+	recorded, err := Get[map[string]string](context.Background(), &apiClient, "/items?api_key=abc&page=1")
+	if err != nil {
+		t.Fatalf("Error recording request: %v", err)
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatalf("Error saving cassette: %v", err)
+	}
+	// The replay must not need the server any more.
+	server.Close()
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "s3cret-token") || strings.Contains(string(data), "abc") || strings.Contains(string(data), "Authorization") {
+		t.Errorf("Expected cassette to be scrubbed, got:\n%s", data)
+	}
+
+	player, err := LoadCassette(path, CassetteReplay)
+	if err != nil {
+		t.Fatalf("Error loading cassette: %v", err)
+	}
+	apiClient = NewAPIClient("http://replayed.invalid", "s3cret-token", WithMiddleware(player.Middleware()))
+	replayed, err := Get[map[string]string](context.Background(), &apiClient, "/items?page=1&api_key=abc")
+	if err != nil {
+		t.Fatalf("Error replaying request: %v", err)
+	}
+	if replayed["path"] != recorded["path"] || replayed["token"] != "Bearer xxxxx" {
+		t.Errorf("Unexpected replayed response %v", replayed)
+	}
+
+	if _, err := Get[map[string]string](context.Background(), &apiClient, "/other"); err == nil {
+		t.Errorf("Expected an error for a request missing from the cassette")
+	}
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ResponseDecoder decodes a response body into the value pointed to by v.
+type ResponseDecoder func(body []byte, v interface{}) error
+
+// defaultDecoders maps media types to the decoder used for them when the client does not override it.
+// JSON is not listed, it is decoded according to the client's JSONOptions.
+var defaultDecoders = map[string]ResponseDecoder{
+	"application/xml": xml.Unmarshal,
+	"text/xml":        xml.Unmarshal,
+}
+
+// decoderFor returns the decoder for the given Content-Type header value.
+// Unknown and missing content types are decoded as JSON, which is what most APIs return regardless of what they claim.
+func (c *AuthenticatedAPIClient) decoderFor(contentType string) ResponseDecoder {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return c.JSON.decoder()
+	}
+
+	if decoder, ok := c.Decoders[mediaType]; ok {
+		return decoder
+	}
+	if decoder, ok := defaultDecoders[mediaType]; ok {
+		return decoder
+	}
+	if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		return c.JSON.decoder()
+	}
+	if strings.HasSuffix(mediaType, "+xml") {
+		return xml.Unmarshal
+	}
+
+	return c.JSON.decoder()
+}
+
+// decodeResponse stores the body of a successful response in response.
+// An io.Writer receives the body as it is streamed, *[]byte and *string receive it verbatim,
+// anything else is decoded based on the Content-Type. An empty body leaves response untouched.
+func (c *AuthenticatedAPIClient) decodeResponse(l *slog.Logger, resp *http.Response, response interface{}) error {
+	if w, ok := response.(io.Writer); ok {
+		_, err := io.Copy(w, resp.Body)
+		return err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	switch target := response.(type) {
+	case *[]byte:
+		*target = body
+		return nil
+	case *string:
+		*target = string(body)
+		return nil
+	}
+
+	if len(body) == 0 || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	if err := c.decoderFor(resp.Header.Get("Content-Type"))(body, response); err != nil {
+		l.Error("Failed to unmarshal response", "error", err, "body", bodySnippet(body))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func decodeTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		case "/text":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("plain text, not JSON"))
+		case "/xml":
+			w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+			_, _ = w.Write([]byte(`<item><name>xml</name></item>`))
+		}
+	}))
+}
+
+func TestEmptyBodyIsSuccess(t *testing.T) {
+	server := decodeTestServer()
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "")
+	resp := map[string]interface{}{"untouched": true}
+	if err := apiClient.DeleteWithContext(context.Background(), "/empty", &resp); err != nil {
+		t.Fatalf("Expected 204 to succeed, got %v", err)
+	}
+	if resp["untouched"] != true {
+		t.Errorf("Expected response to be left untouched, got %v", resp)
+	}
+}
+
+func TestRawResponseTargets(t *testing.T) {
+	server := decodeTestServer()
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "")
+	ctx := context.Background()
+
+	text, err := Get[string](ctx, &apiClient, "/text")
+	if err != nil || text != "plain text, not JSON" {
+		t.Errorf("Expected text body, got %q, %v", text, err)
+	}
+
+	raw, err := Get[[]byte](ctx, &apiClient, "/text")
+	if err != nil || string(raw) != "plain text, not JSON" {
+		t.Errorf("Expected raw body, got %q, %v", raw, err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := apiClient.GetWithContext(ctx, "/text", buf); err != nil || buf.String() != "plain text, not JSON" {
+		t.Errorf("Expected streamed body, got %q, %v", buf.String(), err)
+	}
+}
+
+func TestContentTypeDrivenDecoding(t *testing.T) {
+	server := decodeTestServer()
+	defer server.Close()
+
+	type item struct {
+		XMLName xml.Name `xml:"item"`
+		Name    string   `xml:"name"`
+	}
+
+	apiClient := NewAPIClient(server.URL, "")
+	got, err := Get[item](context.Background(), &apiClient, "/xml")
+	if err != nil || got.Name != "xml" {
+		t.Errorf("Expected XML to be decoded, got %+v, %v", got, err)
+	}
+
+	apiClient.Decoders = map[string]ResponseDecoder{
+		"text/plain": func(body []byte, v interface{}) error {
+			*v.(*map[string]string) = map[string]string{"text": string(body)}
+			return nil
+		},
+	}
+	custom, err := Get[map[string]string](context.Background(), &apiClient, "/text")
+	if err != nil || custom["text"] != "plain text, not JSON" {
+		t.Errorf("Expected custom decoder to be used, got %v, %v", custom, err)
+	}
+}
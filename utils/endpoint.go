@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Endpoint is the path and query string of a request relative to the client's BaseURL.
+// It takes care of escaping so endpoints do not need to be built by string concatenation.
+type Endpoint struct {
+	Segments []string
+	Query    url.Values
+}
+
+// NewEndpoint creates an Endpoint from path segments, segments that are not strings are formatted with fmt.Sprint.
+func NewEndpoint(segments ...interface{}) Endpoint {
+	e := Endpoint{Segments: make([]string, 0, len(segments))}
+	for _, segment := range segments {
+		e.Segments = append(e.Segments, fmt.Sprint(segment))
+	}
+	return e
+}
+
+// With returns a copy of the endpoint with the query parameter key set to value, formatted with fmt.Sprint.
+func (e Endpoint) With(key string, value interface{}) Endpoint {
+	query := url.Values{}
+	for k, v := range e.Query {
+		query[k] = append([]string(nil), v...)
+	}
+	query.Set(key, fmt.Sprint(value))
+	e.Query = query
+	return e
+}
+
+// WithQuery returns a copy of the endpoint with all values in query added to its query parameters.
+func (e Endpoint) WithQuery(query url.Values) Endpoint {
+	merged := url.Values{}
+	for k, v := range e.Query {
+		merged[k] = append([]string(nil), v...)
+	}
+	for k, v := range query {
+		merged[k] = append(merged[k], v...)
+	}
+	e.Query = merged
+	return e
+}
+
+// String returns the escaped endpoint, e.g. "/projects/1/tasks?page=2".
+func (e Endpoint) String() string {
+	var b strings.Builder
+	for _, segment := range e.Segments {
+		b.WriteString("/")
+		b.WriteString(url.PathEscape(segment))
+	}
+	if b.Len() == 0 {
+		b.WriteString("/")
+	}
+	if len(e.Query) > 0 {
+		b.WriteString("?")
+		b.WriteString(e.Query.Encode())
+	}
+	return b.String()
+}
+
+// joinURL joins baseURL and endpoint with exactly one slash between them, so a trailing slash on the
+// base URL (e.g. "https://vikunja.example.com/api/v1/") does not produce a double slash.
+func joinURL(baseURL, endpoint string) string {
+	if endpoint == "" || strings.HasPrefix(endpoint, "?") {
+		return baseURL + endpoint
+	}
+	return strings.TrimRight(baseURL, "/") + "/" + strings.TrimLeft(endpoint, "/")
+}
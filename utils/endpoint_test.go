@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestEndpointString(t *testing.T) {
+	cases := []struct {
+		endpoint Endpoint
+		expected string
+	}{
+		{NewEndpoint(), "/"},
+		{NewEndpoint("projects", 12, "tasks"), "/projects/12/tasks"},
+		{NewEndpoint("labels").With("page", 2).With("per_page", 50), "/labels?page=2&per_page=50"},
+		{NewEndpoint("search", "a/b c"), "/search/a%2Fb%20c"},
+		{NewEndpoint("tasks").WithQuery(url.Values{"filter": {"done = false && priority > 2"}}), "/tasks?filter=done+%3D+false+%26%26+priority+%3E+2"},
+	}
+
+	for _, c := range cases {
+		if got := c.endpoint.String(); got != c.expected {
+			t.Errorf("Expected %q, got %q", c.expected, got)
+		}
+	}
+}
+
+func TestEndpointWithDoesNotModifyOriginal(t *testing.T) {
+	base := NewEndpoint("labels").With("page", 1)
+	_ = base.With("page", 2)
+	if got := base.String(); got != "/labels?page=1" {
+		t.Errorf("Expected original endpoint to be unchanged, got %q", got)
+	}
+}
+
+func TestJoinURL(t *testing.T) {
+	cases := []struct {
+		base, endpoint, expected string
+	}{
+		{"http://vikunja/api/v1", "/projects", "http://vikunja/api/v1/projects"},
+		{"http://vikunja/api/v1/", "/projects", "http://vikunja/api/v1/projects"},
+		{"http://vikunja/api/v1/", "projects?page=1", "http://vikunja/api/v1/projects?page=1"},
+		{"http://vikunja/api/v1", "", "http://vikunja/api/v1"},
+	}
+
+	for _, c := range cases {
+		if got := joinURL(c.base, c.endpoint); got != c.expected {
+			t.Errorf("joinURL(%q, %q) = %q, expected %q", c.base, c.endpoint, got, c.expected)
+		}
+	}
+}
+
+func TestTrailingSlashBaseURL(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.RequestURI()
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL+"/api/v1/", "")
+	if _, err := Get[map[string]interface{}](context.Background(), &apiClient, NewEndpoint("projects", 3).With("page", 1).String()); err != nil {
+		t.Fatalf("Error making GET request: %v", err)
+	}
+	if path != "/api/v1/projects/3?page=1" {
+		t.Errorf("Expected /api/v1/projects/3?page=1, got %s", path)
+	}
+}
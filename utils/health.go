@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultHealthCheckTimeout limits a health check registered without a timeout.
+const DefaultHealthCheckTimeout = 5 * time.Second
+
+// HealthCheck reports whether a component is healthy, a nil error meaning it is.
+type HealthCheck func(ctx context.Context) error
+
+// HealthRegistry holds the named checks behind the /healthz, /readyz and /livez endpoints.
+// Liveness checks tell Kubernetes to restart the process, so they should only fail when it cannot recover by itself,
+// readiness checks take the pod out of the load balancer, e.g. while a dependency is down.
+type HealthRegistry struct {
+	mu     sync.Mutex
+	checks []registeredCheck
+}
+
+// registeredCheck is a check together with its name, timeout and whether it is a liveness check.
+type registeredCheck struct {
+	name     string
+	timeout  time.Duration
+	liveness bool
+	check    HealthCheck
+}
+
+// HealthReport is the JSON body served by the health endpoints.
+type HealthReport struct {
+	// Status is "ok" when every check passed, "failed" otherwise.
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// CheckResult is the outcome of a single check.
+type CheckResult struct {
+	Name string `json:"name"`
+	// Status is "ok" or "failed".
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// NewHealthRegistry creates an empty HealthRegistry, its endpoints report healthy until checks are added.
+func NewHealthRegistry() *HealthRegistry {
+	return &HealthRegistry{}
+}
+
+// AddReadinessCheck registers a check served on /readyz and /healthz, timeout 0 means DefaultHealthCheckTimeout.
+func (h *HealthRegistry) AddReadinessCheck(name string, timeout time.Duration, check HealthCheck) {
+	h.add(registeredCheck{name: name, timeout: timeout, check: check})
+}
+
+// AddLivenessCheck registers a check served on /livez, /readyz and /healthz, timeout 0 means DefaultHealthCheckTimeout.
+func (h *HealthRegistry) AddLivenessCheck(name string, timeout time.Duration, check HealthCheck) {
+	h.add(registeredCheck{name: name, timeout: timeout, liveness: true, check: check})
+}
+
+// add registers check.
+func (h *HealthRegistry) add(check registeredCheck) {
+	if check.timeout <= 0 {
+		check.timeout = DefaultHealthCheckTimeout
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, check)
+}
+
+// Run runs the checks concurrently, only the liveness ones when livenessOnly is set, and reports their outcome.
+func (h *HealthRegistry) Run(ctx context.Context, livenessOnly bool) HealthReport {
+	h.mu.Lock()
+	checks := make([]registeredCheck, 0, len(h.checks))
+	for _, check := range h.checks {
+		if check.liveness || !livenessOnly {
+			checks = append(checks, check)
+		}
+	}
+	h.mu.Unlock()
+
+	report := HealthReport{Status: "ok", Checks: make([]CheckResult, len(checks))}
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = check.run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != "ok" {
+			report.Status = "failed"
+		}
+	}
+	return report
+}
+
+// run runs the check within its timeout, a check ignoring ctx still fails once the timeout passed.
+func (c registeredCheck) run(ctx context.Context) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	errc := make(chan error, 1)
+	go func() { errc <- c.check(ctx) }()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := CheckResult{Name: c.name, Status: "ok", LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Handler serves the report of Run as JSON, with status 503 Service Unavailable when a check failed.
+func (h *HealthRegistry) Handler(livenessOnly bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := h.Run(r.Context(), livenessOnly)
+
+		status := http.StatusOK
+		if report.Status != "ok" {
+			status = http.StatusServiceUnavailable
+			slog.Default().Warn("Health check failed", "path", r.URL.Path, "report", report)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// probe fetches a health endpoint and decodes its report.
+func probe(t *testing.T, url string) (int, HealthReport) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Error probing %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	report := HealthReport{}
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("Error decoding report of %s: %v", url, err)
+	}
+	return resp.StatusCode, report
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	b := NewServerBuilder()
+	server := httptest.NewServer(b.Handler())
+	defer server.Close()
+
+	if status, report := probe(t, server.URL+"/healthz"); status != http.StatusOK || report.Status != "ok" || len(report.Checks) != 0 {
+		t.Errorf("Expected a healthy report without checks, got %d %+v", status, report)
+	}
+
+	dependencyDown := errors.New("connection refused")
+	b.Health().AddLivenessCheck("goroutines", 0, func(context.Context) error { return nil })
+	b.Health().AddReadinessCheck("vikunja", 0, func(context.Context) error { return dependencyDown })
+	b.Health().AddReadinessCheck("slow", 20*time.Millisecond, func(context.Context) error {
+		// Ignores ctx on purpose, the timeout must still apply.
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	status, report := probe(t, server.URL+"/livez")
+	if status != http.StatusOK || len(report.Checks) != 1 || report.Checks[0].Name != "goroutines" {
+		t.Errorf("Expected only the liveness check on /livez, got %d %+v", status, report)
+	}
+
+	start := time.Now()
+	status, report = probe(t, server.URL+"/readyz")
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Expected the slow check to time out, the probe took %v", time.Since(start))
+	}
+	if status != http.StatusServiceUnavailable || report.Status != "failed" || len(report.Checks) != 3 {
+		t.Fatalf("Expected a failed report with 3 checks, got %d %+v", status, report)
+	}
+	results := map[string]CheckResult{}
+	for _, result := range report.Checks {
+		results[result.Name] = result
+	}
+	if results["goroutines"].Status != "ok" || results["vikunja"].Error != "connection refused" {
+		t.Errorf("Unexpected check results %+v", results)
+	}
+	if slow := results["slow"]; slow.Status != "failed" || slow.Error != context.DeadlineExceeded.Error() || slow.LatencyMS < 20 {
+		t.Errorf("Expected the slow check to fail on its timeout, got %+v", slow)
+	}
+}
@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// IdempotencyKeyHeader is the header carrying the idempotency key of a mutating request.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyKeyKey is the context key under which ContextWithIdempotencyKey stores the key.
+type idempotencyKeyKey struct{}
+
+// ContextWithIdempotencyKey returns a copy of ctx carrying key, it is sent as the Idempotency-Key header of
+// mutating requests made with ctx. Reusing the key when an automation reruns lets the server spot the duplicate.
+func ContextWithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyKey{}, key)
+}
+
+// idempotencyKey returns the key a mutating request made with ctx is sent with, "" if it gets none.
+func (c *AuthenticatedAPIClient) idempotencyKey(ctx context.Context, method string) string {
+	if isSafeMethod(method) {
+		return ""
+	}
+	if key, _ := ctx.Value(idempotencyKeyKey{}).(string); key != "" {
+		return key
+	}
+	if c.IdempotencyKeys {
+		return NewRequestID()
+	}
+	return ""
+}
+
+// Deduplicator performs client-side check-then-act deduplication for APIs without idempotency key support:
+// an action whose key already succeeded within Window is skipped, and concurrent calls with the same key run it once.
+// The zero value is ready to use and a nil *Deduplicator deduplicates nothing, only asking check. It is safe for
+// concurrent use.
+type Deduplicator struct {
+	Window time.Duration
+
+	mu       sync.Mutex
+	done     map[string]time.Time
+	inFlight map[string]*dedupCall
+}
+
+// dedupCall is an action in progress that concurrent callers with the same key wait for.
+type dedupCall struct {
+	finished  chan struct{}
+	performed bool
+	err       error
+}
+
+// NewDeduplicator creates a Deduplicator remembering successful actions for window.
+func NewDeduplicator(window time.Duration) *Deduplicator {
+	return &Deduplicator{Window: window}
+}
+
+// Do runs act unless an action with the same key succeeded within the window, or check reports it is already done.
+// check may be nil, otherwise it is asked first, e.g. whether the label is already on the task. performed reports
+// whether act ran, callers waiting on a concurrent call with the same key get that call's result.
+func (d *Deduplicator) Do(ctx context.Context, key string, check func(ctx context.Context) (bool, error), act func(ctx context.Context) error) (performed bool, err error) {
+	if d == nil {
+		return d.run(ctx, check, act)
+	}
+
+	d.mu.Lock()
+	if d.done == nil {
+		d.done, d.inFlight = map[string]time.Time{}, map[string]*dedupCall{}
+	}
+	if at, ok := d.done[key]; ok && time.Since(at) < d.Window {
+		d.mu.Unlock()
+		return false, nil
+	}
+	if call, ok := d.inFlight[key]; ok {
+		d.mu.Unlock()
+		select {
+		case <-call.finished:
+			return false, call.err
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+	call := &dedupCall{finished: make(chan struct{})}
+	d.inFlight[key] = call
+	d.mu.Unlock()
+
+	call.performed, call.err = d.run(ctx, check, act)
+
+	d.mu.Lock()
+	delete(d.inFlight, key)
+	if call.err == nil {
+		d.done[key] = time.Now()
+	}
+	d.prune()
+	d.mu.Unlock()
+	close(call.finished)
+
+	return call.performed, call.err
+}
+
+// run asks check, if any, and performs act when the action is not done yet.
+func (d *Deduplicator) run(ctx context.Context, check func(ctx context.Context) (bool, error), act func(ctx context.Context) error) (bool, error) {
+	if check != nil {
+		alreadyDone, err := check(ctx)
+		if err != nil || alreadyDone {
+			return false, err
+		}
+	}
+	if err := act(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// prune forgets keys older than the window, d.mu must be held.
+func (d *Deduplicator) prune() {
+	for key, at := range d.done {
+		if time.Since(at) >= d.Window {
+			delete(d.done, key)
+		}
+	}
+}
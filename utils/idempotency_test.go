@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKeyRetry(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys = append(keys, r.Header.Get(IdempotencyKeyHeader))
+		attempt := len(keys)
+		mu.Unlock()
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		if attempt == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id": 1}`))
+	}))
+	defer server.Close()
+
+	policy := DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	policy.TrustIdempotencyKey = true
+	apiClient := NewAPIClient(server.URL, "", WithRetry(policy), WithIdempotencyKeys())
+	ctx := context.Background()
+
+	if _, err := Post[map[string]int](ctx, &apiClient, "/webhooks", map[string]int{}); err != nil {
+		t.Fatalf("Expected the keyed POST to be retried, got %v", err)
+	}
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+		t.Errorf("Expected both attempts to carry the same key, got %q", keys)
+	}
+
+	keys = nil
+	ctx = ContextWithIdempotencyKey(ctx, "sync-42")
+	if _, err := Post[map[string]int](ctx, &apiClient, "/webhooks", map[string]int{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := Get[map[string]int](ctx, &apiClient, "/webhooks"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(keys) != 3 || keys[0] != "sync-42" || keys[1] != "sync-42" || keys[2] != "" {
+		t.Errorf("Expected the context key on the POST attempts only, got %q", keys)
+	}
+
+	// Without keys a failed POST is not retried.
+	keys = nil
+	apiClient = NewAPIClient(server.URL, "", WithRetry(policy))
+	if _, err := Post[map[string]int](context.Background(), &apiClient, "/webhooks", map[string]int{}); err == nil {
+		t.Errorf("Expected the unkeyed POST to fail without a retry")
+	}
+	if len(keys) != 1 || keys[0] != "" {
+		t.Errorf("Expected a single attempt without a key, got %q", keys)
+	}
+}
+
+func TestDeduplicator(t *testing.T) {
+	dedup := NewDeduplicator(time.Hour)
+	ctx := context.Background()
+	var acts atomic.Int32
+	act := func(context.Context) error {
+		acts.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	var performed atomic.Int32
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := dedup.Do(ctx, "label-1", nil, act)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if ok {
+				performed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if acts.Load() != 1 || performed.Load() != 1 {
+		t.Errorf("Expected concurrent calls to act once, got %d acts and %d performed", acts.Load(), performed.Load())
+	}
+
+	if ok, _ := dedup.Do(ctx, "label-1", nil, act); ok || acts.Load() != 1 {
+		t.Errorf("Expected the key to be remembered within the window")
+	}
+
+	alreadyDone := func(context.Context) (bool, error) { return true, nil }
+	if ok, err := dedup.Do(ctx, "label-2", alreadyDone, act); ok || err != nil || acts.Load() != 1 {
+		t.Errorf("Expected the check to skip the action, got %v, %v", ok, err)
+	}
+
+	failing := errors.New("upstream down")
+	if _, err := dedup.Do(ctx, "label-3", nil, func(context.Context) error { return failing }); !errors.Is(err, failing) {
+		t.Errorf("Expected the action error, got %v", err)
+	}
+	if ok, _ := dedup.Do(ctx, "label-3", nil, act); !ok {
+		t.Errorf("Expected a failed action to be attempted again")
+	}
+
+	dedup.Window = 0
+	if ok, _ := dedup.Do(ctx, "label-1", nil, act); !ok {
+		t.Errorf("Expected the key to be forgotten once the window passed")
+	}
+}
+
+func TestCreatingPutIsNotRetried(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		// The webhook was created, but the proxy in front of the server lost the response.
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	// Vikunja creates resources with PUT, so its client leaves PUT out of the idempotent methods.
+	vikunjaPolicy := func() *RetryPolicy {
+		policy := DefaultRetryPolicy()
+		policy.InitialBackoff = time.Millisecond
+		policy.IdempotentMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodDelete}
+		return policy
+	}
+	allowed := vikunjaPolicy()
+	allowed.RetryNonIdempotent = true
+	trusted := vikunjaPolicy()
+	trusted.TrustIdempotencyKey = true
+	keyed := ContextWithIdempotencyKey(context.Background(), "webhook-1")
+
+	cases := []struct {
+		name     string
+		policy   *RetryPolicy
+		ctx      context.Context
+		expected int32
+	}{
+		{"vikunja policy", vikunjaPolicy(), context.Background(), 1},
+		{"explicitly allowed", allowed, context.Background(), 3},
+		// Vikunja ignores the header, so carrying one does not make the PUT safe to repeat.
+		{"idempotency key", vikunjaPolicy(), keyed, 1},
+		{"trusted idempotency key", trusted, keyed, 3},
+	}
+	for _, c := range cases {
+		attempts.Store(0)
+		apiClient := NewAPIClient(server.URL, "", WithRetry(c.policy))
+		if _, err := Put[map[string]int](c.ctx, &apiClient, "/projects/1/webhooks", map[string]string{"target_url": "https://example.com"}); err == nil {
+			t.Errorf("%s: expected the 502 to be returned", c.name)
+		}
+		if attempts.Load() != c.expected {
+			t.Errorf("%s: expected %d attempts, got %d", c.name, c.expected, attempts.Load())
+		}
+	}
+}
+
+func TestDeduplicatorZeroAndNil(t *testing.T) {
+	ctx := context.Background()
+	act := func(context.Context) error { return nil }
+
+	zero := &Deduplicator{Window: time.Hour}
+	if ok, err := zero.Do(ctx, "label-1", nil, act); !ok || err != nil {
+		t.Errorf("Expected the zero value to act, got %v, %v", ok, err)
+	}
+	if ok, _ := zero.Do(ctx, "label-1", nil, act); ok {
+		t.Errorf("Expected the zero value to remember the key")
+	}
+
+	var none *Deduplicator
+	for range 2 {
+		if ok, err := none.Do(ctx, "label-1", nil, act); !ok || err != nil {
+			t.Errorf("Expected a nil Deduplicator to act every time, got %v, %v", ok, err)
+		}
+	}
+	alreadyDone := func(context.Context) (bool, error) { return true, nil }
+	if ok, _ := none.Do(ctx, "label-1", alreadyDone, act); ok {
+		t.Errorf("Expected a nil Deduplicator to still ask check")
+	}
+}
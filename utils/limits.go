@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrResponseTooLarge is matched by errors.Is when a response body exceeds the client's MaxResponseSize.
+var ErrResponseTooLarge = errors.New("response too large")
+
+// ResponseTooLargeError is returned when a response body exceeds the client's MaxResponseSize.
+type ResponseTooLargeError struct {
+	// Limit is the MaxResponseSize that was exceeded.
+	Limit int64
+	// URL is the request URL with credentials redacted.
+	URL string
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return "response from " + e.URL + " exceeds the limit of " + strconv.FormatInt(e.Limit, 10) + " bytes"
+}
+
+// Is makes errors.Is(err, ErrResponseTooLarge) match a *ResponseTooLargeError.
+func (e *ResponseTooLargeError) Is(target error) bool {
+	return target == ErrResponseTooLarge
+}
+
+// maxErrorBodySize caps how much of a non-2xx response body is read into an APIError.
+const maxErrorBodySize = 64 << 10
+
+// maxBodySnippet is how much of a body is kept in log lines and APIError messages.
+const maxBodySnippet = 512
+
+// JSONOptions selects strict JSON decoding of response bodies.
+type JSONOptions struct {
+	// DisallowUnknownFields fails decoding when the body has a field the target struct does not.
+	DisallowUnknownFields bool
+	// UseNumber decodes numbers into interface{} values as json.Number instead of float64, keeping large IDs exact.
+	UseNumber bool
+}
+
+// decoder returns the JSON ResponseDecoder honouring the options, json.Unmarshal when none is set.
+func (o JSONOptions) decoder() ResponseDecoder {
+	if o == (JSONOptions{}) {
+		return json.Unmarshal
+	}
+	return func(body []byte, v interface{}) error {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		if o.DisallowUnknownFields {
+			dec.DisallowUnknownFields()
+		}
+		if o.UseNumber {
+			dec.UseNumber()
+		}
+		if err := dec.Decode(v); err != nil {
+			return err
+		}
+		// json.Unmarshal rejects trailing data, so does the strict decoder.
+		if _, err := dec.Token(); err != io.EOF {
+			return errors.New("invalid character after top-level value")
+		}
+		return nil
+	}
+}
+
+// sendLimited sends req like send and caps the response body at MaxResponseSize.
+func (c *AuthenticatedAPIClient) sendLimited(req *http.Request) (*http.Response, error) {
+	resp, err := c.send(req)
+	if err != nil || c.MaxResponseSize <= 0 {
+		return resp, err
+	}
+	// These responses have no body whatever their Content-Length says, e.g. the size of the resource for HEAD.
+	if req.Method == http.MethodHead || resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+	resp.Body = &limitedBody{
+		ReadCloser:    resp.Body,
+		remaining:     c.MaxResponseSize,
+		contentLength: resp.ContentLength,
+		err:           &ResponseTooLargeError{Limit: c.MaxResponseSize, URL: redactURL(req.URL)},
+	}
+	return resp, nil
+}
+
+// limitedBody is a response body that fails with a ResponseTooLargeError once more than the limit is read.
+// A Content-Length above the limit fails the first read without reading anything.
+type limitedBody struct {
+	io.ReadCloser
+	remaining     int64
+	contentLength int64
+	err           *ResponseTooLargeError
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 || b.contentLength > b.err.Limit {
+		return 0, b.err
+	}
+	// Reading one byte past the limit tells a body of exactly the limit apart from a larger one.
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remaining {
+		n = int(b.remaining)
+		b.remaining = -1
+		return n, b.err
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// readErrorBody reads at most maxErrorBodySize bytes of a non-2xx response body.
+// A body cut short by MaxResponseSize is still returned, the error response is more useful than the size error.
+func readErrorBody(r io.Reader) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r, maxErrorBodySize))
+	if err != nil && !errors.Is(err, ErrResponseTooLarge) {
+		return nil, err
+	}
+	return body, nil
+}
+
+// bodySnippet returns body for logging, cut down to maxBodySnippet bytes with a note of how much was left out.
+func bodySnippet(body []byte) string {
+	if len(body) <= maxBodySnippet {
+		return string(body)
+	}
+	return strings.ToValidUTF8(string(body[:maxBodySnippet]), "") + "... (" + strconv.Itoa(len(body)-maxBodySnippet) + " more bytes)"
+}
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaxResponseSize(t *testing.T) {
+	large := strings.Repeat("a", 2048)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chunked":
+			// Flushing before writing drops the Content-Length, so the limit is hit while reading.
+			w.(http.Flusher).Flush()
+			_, _ = w.Write([]byte(`"` + large + `"`))
+		case "/error":
+			http.Error(w, large, http.StatusInternalServerError)
+		case "/large-file":
+			// A HEAD response announces the size of the resource, and so may a 304.
+			w.Header().Set("Content-Length", "4096")
+			if r.Method != http.MethodHead {
+				w.WriteHeader(http.StatusNotModified)
+			}
+		case "/exact":
+			_, _ = w.Write([]byte(`"` + strings.Repeat("a", 1022) + `"`))
+		default:
+			_, _ = w.Write([]byte(`"` + large + `"`))
+		}
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "", WithMaxResponseSize(1024))
+	ctx := context.Background()
+
+	for _, path := range []string{"/content-length", "/chunked"} {
+		_, err := Get[string](ctx, &apiClient, path)
+		tooLarge := &ResponseTooLargeError{}
+		if !errors.Is(err, ErrResponseTooLarge) || !errors.As(err, &tooLarge) || tooLarge.Limit != 1024 {
+			t.Errorf("Expected ErrResponseTooLarge for %s, got %v", path, err)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := apiClient.GetWithContext(ctx, "/chunked", buf); !errors.Is(err, ErrResponseTooLarge) || buf.Len() > 1024 {
+		t.Errorf("Expected a streamed body to stop at the limit, got %d bytes, %v", buf.Len(), err)
+	}
+
+	if got, err := Get[string](ctx, &apiClient, "/exact"); err != nil || len(got) != 1024 {
+		t.Errorf("Expected a body of exactly the limit to be accepted, got %d bytes, %v", len(got), err)
+	}
+
+	if header, err := apiClient.HeadWithContext(ctx, "/large-file"); err != nil || header.Get("Content-Length") != "4096" {
+		t.Errorf("Expected a HEAD response not to be limited, got %v, %v", header, err)
+	}
+	notModified := &APIError{}
+	if err := apiClient.GetWithContext(ctx, "/large-file", buf); !errors.As(err, &notModified) || notModified.StatusCode != http.StatusNotModified {
+		t.Errorf("Expected an APIError for a 304 rather than its Content-Length, got %v", err)
+	}
+
+	_, err := Get[string](ctx, &apiClient, "/error")
+	apiErr := &APIError{}
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("Expected an APIError for an oversized error body, got %v", err)
+	}
+	if !strings.HasSuffix(apiErr.Message, "more bytes)") || len(apiErr.Message) > maxBodySnippet+32 {
+		t.Errorf("Expected a truncated error message, got %d bytes", len(apiErr.Message))
+	}
+}
+
+func TestStrictJSONDecoding(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": 9007199254740993, "title": "Inbox", "hex_color": "e8e8e8"}`))
+	}))
+	defer server.Close()
+
+	type project struct {
+		ID    int64  `json:"id"`
+		Title string `json:"title"`
+	}
+	ctx := context.Background()
+
+	apiClient := NewAPIClient(server.URL, "")
+	if _, err := Get[project](ctx, &apiClient, "/project"); err != nil {
+		t.Errorf("Expected unknown fields to be ignored by default, got %v", err)
+	}
+
+	apiClient = NewAPIClient(server.URL, "", WithJSONOptions(JSONOptions{DisallowUnknownFields: true}))
+	if _, err := Get[project](ctx, &apiClient, "/project"); err == nil || !strings.Contains(err.Error(), "hex_color") {
+		t.Errorf("Expected an unknown field error, got %v", err)
+	}
+
+	apiClient = NewAPIClient(server.URL, "", WithJSONOptions(JSONOptions{UseNumber: true}))
+	got, err := Get[map[string]interface{}](ctx, &apiClient, "/project")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if id, ok := got["id"].(json.Number); !ok || id.String() != "9007199254740993" {
+		t.Errorf("Expected the id as an exact json.Number, got %#v", got["id"])
+	}
+}
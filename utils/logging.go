@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"log/slog"
 	"os"
 )
@@ -12,3 +13,19 @@ func GetInitLogger() *slog.Logger {
 
 	return l
 }
+
+// loggerKey is the context key under which ContextWithLogger stores the logger.
+type loggerKey struct{}
+
+// ContextWithLogger returns a copy of ctx carrying l, e.g. a logger with the request ID attached.
+func ContextWithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// LoggerFromContext returns the logger stored in ctx by ContextWithLogger, slog.Default() if there is none.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
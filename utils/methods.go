@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// HTTP methods accepted by MakeAPIRequest and AuthenticatedAPIClient, any other valid method token works too.
+const (
+	MethodGet     = http.MethodGet
+	MethodHead    = http.MethodHead
+	MethodPost    = http.MethodPost
+	MethodPut     = http.MethodPut
+	MethodPatch   = http.MethodPatch
+	MethodDelete  = http.MethodDelete
+	MethodOptions = http.MethodOptions
+)
+
+// BodyPolicy reports whether requests with the given method may carry a body.
+type BodyPolicy func(method string) bool
+
+// DefaultBodyPolicy forbids bodies on GET, HEAD, DELETE, OPTIONS and TRACE requests, whose bodies have no defined meaning.
+func DefaultBodyPolicy(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodDelete, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+	return true
+}
+
+// AllowDeleteBodyPolicy is DefaultBodyPolicy but also allows DELETE bodies, which some APIs use to select what to delete.
+func AllowDeleteBodyPolicy(method string) bool {
+	return strings.EqualFold(method, http.MethodDelete) || DefaultBodyPolicy(method)
+}
+
+// allowsBody reports whether the client's BodyPolicy lets requests with method carry a body.
+func (c *AuthenticatedAPIClient) allowsBody(method string) bool {
+	if c.BodyPolicy == nil {
+		return DefaultBodyPolicy(method)
+	}
+	return c.BodyPolicy(method)
+}
+
+// isSafeMethod reports whether a request with the given method only reads, so it cannot invalidate cached responses.
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// Patch is a helper function to make a PATCH request to the specified endpoint, authenticated with the client's Authenticator or Token.
+func (c *AuthenticatedAPIClient) Patch(endpoint string, request, response interface{}) error {
+	return c.PatchWithContext(context.Background(), endpoint, request, response)
+}
+
+// PatchWithContext is the same as Patch but binds the request to ctx, cancelling ctx aborts the request.
+func (c *AuthenticatedAPIClient) PatchWithContext(ctx context.Context, endpoint string, request, response interface{}) error {
+	return c.makeRequest(ctx, http.MethodPatch, endpoint, request, response)
+}
+
+// Head makes a HEAD request to the specified endpoint and returns the response headers.
+func (c *AuthenticatedAPIClient) Head(endpoint string) (http.Header, error) {
+	return c.HeadWithContext(context.Background(), endpoint)
+}
+
+// HeadWithContext is the same as Head but binds the request to ctx, cancelling ctx aborts the request.
+func (c *AuthenticatedAPIClient) HeadWithContext(ctx context.Context, endpoint string) (http.Header, error) {
+	return c.doRequest(ctx, http.MethodHead, endpoint, nil, io.Discard)
+}
+
+// Options makes an OPTIONS request to the specified endpoint and returns the response headers, e.g. Allow.
+func (c *AuthenticatedAPIClient) Options(endpoint string) (http.Header, error) {
+	return c.OptionsWithContext(context.Background(), endpoint)
+}
+
+// OptionsWithContext is the same as Options but binds the request to ctx, cancelling ctx aborts the request.
+func (c *AuthenticatedAPIClient) OptionsWithContext(ctx context.Context, endpoint string) (http.Header, error) {
+	return c.doRequest(ctx, http.MethodOptions, endpoint, nil, io.Discard)
+}
+
+// MakePatchRequest is a helper function to make a PATCH request to the specified endpoint. If token is not "" it will be added to the request as a Bearer token.
+func MakePatchRequest(client *http.Client, apiBaseURL, endpoint, token string, request, response interface{}) error {
+	return MakeAPIRequest(client, http.MethodPatch, apiBaseURL, endpoint, token, request, response)
+}
+
+// isKnownMethod reports whether method is one of the standard methods, others are not used as label values.
+func isKnownMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+		http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func methodServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Allow", "GET, HEAD, PATCH, DELETE, OPTIONS")
+		w.Header().Set("X-Method", r.Method)
+		if r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"method": r.Method, "body": string(body)})
+	}))
+}
+
+func TestPatchHeadAndOptions(t *testing.T) {
+	server := methodServer()
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "")
+	ctx := context.Background()
+
+	patched, err := Patch[map[string]string](ctx, &apiClient, "/task", map[string]string{"done": "true"})
+	if err != nil || patched["method"] != MethodPatch || patched["body"] != `{"done":"true"}` {
+		t.Errorf("Unexpected PATCH response %v, %v", patched, err)
+	}
+
+	header, err := apiClient.HeadWithContext(ctx, "/task")
+	if err != nil || header.Get("X-Method") != MethodHead {
+		t.Errorf("Unexpected HEAD response headers %v, %v", header, err)
+	}
+
+	header, err = apiClient.OptionsWithContext(ctx, "/task")
+	if err != nil || header.Get("Allow") != "GET, HEAD, PATCH, DELETE, OPTIONS" {
+		t.Errorf("Unexpected OPTIONS response headers %v, %v", header, err)
+	}
+}
+
+func TestBodyPolicy(t *testing.T) {
+	server := methodServer()
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "")
+	resp := map[string]string{}
+	err := apiClient.makeRequest(context.Background(), MethodDelete, "/labels", map[string]int{"id": 1}, &resp)
+	if devErr, ok := err.(*DeveloperError); !ok || devErr.Message != "DELETE requests do not support request bodies" {
+		t.Errorf("Expected DeveloperError for DELETE body under the default policy, got %v", err)
+	}
+
+	apiClient = NewAPIClient(server.URL, "", WithBodyPolicy(AllowDeleteBodyPolicy))
+	if err := apiClient.makeRequest(context.Background(), MethodDelete, "/labels", map[string]int{"id": 1}, &resp); err != nil {
+		t.Fatalf("Expected DELETE body to be allowed, got %v", err)
+	}
+	if resp["body"] != `{"id":1}` {
+		t.Errorf("Expected the DELETE body to reach the server, got %v", resp)
+	}
+	if AllowDeleteBodyPolicy(MethodGet) {
+		t.Errorf("Expected GET bodies to stay forbidden")
+	}
+}
@@ -0,0 +1,355 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are histogram buckets in seconds suited to HTTP request durations.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// DefaultMetrics is the registry served on /metrics by a ServerBuilder unless it is given another one,
+// packages publish their metrics on it.
+var DefaultMetrics = NewMetricsRegistry()
+
+// MetricsRegistry holds counters, gauges and histograms and writes them in the Prometheus text exposition format.
+// It is safe for concurrent use.
+type MetricsRegistry struct {
+	mu      sync.Mutex
+	metrics map[string]collector
+}
+
+// collector is a registered counter, gauge or histogram.
+type collector interface {
+	kind() string
+	help() string
+	labelNames() []string
+	// write writes the samples of the metric, sorted by label values.
+	write(w *bufio.Writer, name string)
+}
+
+// NewMetricsRegistry creates an empty MetricsRegistry.
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{metrics: map[string]collector{}}
+}
+
+// register returns the metric registered as name, creating it with create if there is none.
+// Registering a name again with another type or other labels is a programming error and panics.
+func (r *MetricsRegistry) register(name, kind string, labelNames []string, create func() collector) collector {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.metrics[name]; ok {
+		if existing.kind() != kind || !slices.Equal(existing.labelNames(), labelNames) {
+			panic(fmt.Sprintf("metric %s registered again as %s with labels %v", name, kind, labelNames))
+		}
+		return existing
+	}
+	m := create()
+	r.metrics[name] = m
+	return m
+}
+
+// Counter returns the counter called name, registering it on first use.
+func (r *MetricsRegistry) Counter(name, help string, labelNames ...string) *Counter {
+	return r.register(name, "counter", labelNames, func() collector {
+		return &Counter{family: newFamily[float64](help, labelNames)}
+	}).(*Counter)
+}
+
+// Gauge returns the gauge called name, registering it on first use.
+func (r *MetricsRegistry) Gauge(name, help string, labelNames ...string) *Gauge {
+	return r.register(name, "gauge", labelNames, func() collector {
+		return &Gauge{family: newFamily[float64](help, labelNames)}
+	}).(*Gauge)
+}
+
+// Histogram returns the histogram called name, registering it on first use. nil buckets means DefaultBuckets.
+func (r *MetricsRegistry) Histogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = slices.Sorted(slices.Values(buckets))
+	return r.register(name, "histogram", labelNames, func() collector {
+		return &Histogram{family: newFamily[*histogramValue](help, labelNames), buckets: buckets}
+	}).(*Histogram)
+}
+
+// WriteTo writes every metric in the Prometheus text exposition format, sorted by name.
+func (r *MetricsRegistry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	metrics := make(map[string]collector, len(r.metrics))
+	for name, m := range r.metrics {
+		metrics[name] = m
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, name := range names {
+		m := metrics[name]
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, escapeHelp(m.help()))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, m.kind())
+		m.write(bw, name)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler serves the metrics in the Prometheus text exposition format.
+func (r *MetricsRegistry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = r.WriteTo(w)
+	})
+}
+
+// ClientMetricsMiddleware records the count and duration of outgoing requests per host on metrics,
+// e.g. WithMiddleware(ClientMetricsMiddleware(DefaultMetrics)) publishes them next to the server metrics.
+func ClientMetricsMiddleware(metrics *MetricsRegistry) Middleware {
+	requests := metrics.Counter("http_client_requests_total", "Requests sent, by host and status code.", "method", "host", "code")
+	duration := metrics.Histogram("http_client_request_duration_seconds", "Duration of requests sent, by host.", nil, "method", "host")
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+
+			code := "error"
+			if err == nil {
+				code = strconv.Itoa(resp.StatusCode)
+			}
+			requests.Inc(req.Method, req.URL.Host, code)
+			duration.Observe(time.Since(start).Seconds(), req.Method, req.URL.Host)
+			return resp, err
+		})
+	}
+}
+
+// countingWriter counts the bytes written through it for WriteTo.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// family holds the per label values series of a metric.
+type family[V any] struct {
+	helpText string
+	labels   []string
+
+	mu     sync.Mutex
+	series map[string]*labelledValue[V]
+}
+
+// labelledValue is one series of a family.
+type labelledValue[V any] struct {
+	labelValues []string
+	value       V
+}
+
+func newFamily[V any](help string, labelNames []string) family[V] {
+	return family[V]{helpText: help, labels: labelNames, series: map[string]*labelledValue[V]{}}
+}
+
+func (f *family[V]) help() string         { return f.helpText }
+func (f *family[V]) labelNames() []string { return f.labels }
+
+// with runs update on the series for labelValues, creating it with init if it does not exist yet.
+// A wrong number of label values is a programming error and panics.
+func (f *family[V]) with(labelValues []string, init func() V, update func(v *V)) {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric with labels %v got %d label values", f.labels, len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &labelledValue[V]{labelValues: slices.Clone(labelValues), value: init()}
+		f.series[key] = s
+	}
+	update(&s.value)
+}
+
+// each calls fn for every series in the order of their label values, holding the lock.
+func (f *family[V]) each(fn func(labels string, v V)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := f.series[key]
+		fn(formatLabels(f.labels, s.labelValues), s.value)
+	}
+}
+
+// Counter is a value that only goes up, e.g. the number of requests served.
+type Counter struct {
+	family[float64]
+}
+
+func (c *Counter) kind() string { return "counter" }
+
+// Inc adds 1 to the series for labelValues.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the series for labelValues.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("counter cannot decrease")
+	}
+	c.with(labelValues, func() float64 { return 0 }, func(value *float64) { *value += v })
+}
+
+func (c *Counter) write(w *bufio.Writer, name string) {
+	c.each(func(labels string, v float64) {
+		fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(v))
+	})
+}
+
+// Gauge is a value that goes up and down, e.g. the number of requests in flight.
+type Gauge struct {
+	family[float64]
+}
+
+func (g *Gauge) kind() string { return "gauge" }
+
+// Set sets the series for labelValues to v.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.with(labelValues, func() float64 { return 0 }, func(value *float64) { *value = v })
+}
+
+// Add adds v, which may be negative, to the series for labelValues.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.with(labelValues, func() float64 { return 0 }, func(value *float64) { *value += v })
+}
+
+// Inc adds 1 to the series for labelValues.
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+// Dec subtracts 1 from the series for labelValues.
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+func (g *Gauge) write(w *bufio.Writer, name string) {
+	g.each(func(labels string, v float64) {
+		fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(v))
+	})
+}
+
+// Histogram counts observations, e.g. request durations, in cumulative buckets.
+type Histogram struct {
+	family[*histogramValue]
+	buckets []float64
+}
+
+// histogramValue is one series of a histogram, counts[i] being the observations in bucket i alone.
+type histogramValue struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *Histogram) kind() string { return "histogram" }
+
+// Observe records v in the series for labelValues.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.with(labelValues, func() *histogramValue {
+		return &histogramValue{counts: make([]uint64, len(h.buckets))}
+	}, func(value **histogramValue) {
+		hv := *value
+		if i, _ := slices.BinarySearch(h.buckets, v); i < len(h.buckets) {
+			hv.counts[i]++
+		}
+		hv.sum += v
+		hv.count++
+	})
+}
+
+func (h *Histogram) write(w *bufio.Writer, name string) {
+	h.each(func(labels string, hv *histogramValue) {
+		// The le label goes last, inside the braces of the other labels.
+		prefix := "{"
+		if labels != "" {
+			prefix = strings.TrimSuffix(labels, "}") + ","
+		}
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += hv.counts[i]
+			fmt.Fprintf(w, "%s_bucket%sle=\"%s\"} %d\n", name, prefix, formatFloat(bound), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%sle=\"+Inf\"} %d\n", name, prefix, hv.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatFloat(hv.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, labels, hv.count)
+	})
+}
+
+// formatLabels renders label pairs as {name="value",...}, "" when there are none.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(labelValueEscaper.Replace(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// labelValueEscaper escapes label values as the text exposition format requires.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeHelp escapes a help text as the text exposition format requires.
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+// formatFloat renders v the way Prometheus expects, including +Inf, -Inf and NaN.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsRegistryExposition(t *testing.T) {
+	r := NewMetricsRegistry()
+	r.Counter("jobs_total", "Jobs run.\nBy result.", "result").Add(2, "ok")
+	r.Counter("jobs_total", "Jobs run.\nBy result.", "result").Inc(`say "hi"`)
+	r.Gauge("queue_depth", "Jobs waiting.").Set(3)
+	latency := r.Histogram("job_seconds", "Job latency.", []float64{1, 0.5}, "queue")
+	latency.Observe(0.5, "default")
+	latency.Observe(0.7, "default")
+	latency.Observe(4, "default")
+
+	out := &strings.Builder{}
+	if _, err := r.WriteTo(out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `# HELP job_seconds Job latency.
+# TYPE job_seconds histogram
+job_seconds_bucket{queue="default",le="0.5"} 1
+job_seconds_bucket{queue="default",le="1"} 2
+job_seconds_bucket{queue="default",le="+Inf"} 3
+job_seconds_sum{queue="default"} 5.2
+job_seconds_count{queue="default"} 3
+# HELP jobs_total Jobs run.\nBy result.
+# TYPE jobs_total counter
+jobs_total{result="ok"} 2
+jobs_total{result="say \"hi\""} 1
+# HELP queue_depth Jobs waiting.
+# TYPE queue_depth gauge
+queue_depth 3
+`
+	if out.String() != expected {
+		t.Errorf("Unexpected exposition:\n%s", out.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected registering a name with another type to panic")
+		}
+	}()
+	r.Gauge("jobs_total", "Jobs run.", "result")
+}
+
+func TestServerAndClientMetrics(t *testing.T) {
+	metrics := NewMetricsRegistry()
+	b := NewServerBuilder()
+	b.SetMetrics(metrics)
+	if b.Metrics() != metrics {
+		t.Fatalf("Expected the builder to hand out the registry it records on")
+	}
+	b.HandleFunc("GET /tasks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	})
+	b.HandleFunc("POST /fail", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusBadGateway)
+	})
+	server := httptest.NewServer(b.Handler())
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "", WithMiddleware(ClientMetricsMiddleware(metrics)))
+	ctx := context.Background()
+	for _, id := range []string{"1", "2"} {
+		if _, err := Get[map[string]string](ctx, &apiClient, "/tasks/"+id); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	_, _ = Post[map[string]string, any](ctx, &apiClient, "/fail", nil)
+	_, _ = Get[map[string]string](ctx, &apiClient, "/missing")
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	for _, line := range []string{
+		`http_server_requests_total{method="GET",route="GET /tasks/{id}",code="200"} 2`,
+		`http_server_requests_total{method="POST",route="POST /fail",code="502"} 1`,
+		`http_server_requests_total{method="GET",route="unmatched",code="404"} 1`,
+		`http_server_request_duration_seconds_count{method="GET",route="GET /tasks/{id}"} 2`,
+		`http_server_requests_in_flight{method="GET",route="GET /metrics"} 1`,
+		`http_client_requests_total{method="GET",host="` + host + `",code="200"} 2`,
+		`http_client_request_duration_seconds_count{method="POST",host="` + host + `"} 1`,
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("Expected %q in the exposition:\n%s", line, body)
+		}
+	}
+}
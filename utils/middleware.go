@@ -0,0 +1,210 @@
+package utils
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RoundTripperFunc adapts an ordinary function to the http.RoundTripper interface.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req).
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware decorates a RoundTripper with cross-cutting behaviour such as logging or extra headers.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// Chain wraps base in the given middlewares, the first middleware is the outermost and sees the request first.
+// A nil base means http.DefaultTransport.
+func Chain(base http.RoundTripper, middlewares ...Middleware) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		base = middlewares[i](base)
+	}
+	return base
+}
+
+// LoggingMiddleware logs every request with its status and duration through l, slog.Default() is used when l is nil.
+func LoggingMiddleware(l *slog.Logger) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			logger := l
+			if logger == nil {
+				logger = slog.Default()
+			}
+			logger = logger.With("method", req.Method, "url", redactURL(req.URL))
+
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			if err != nil {
+				logger.Error("API request failed", "error", err, "duration", time.Since(start))
+				return nil, err
+			}
+			logger.Info("API request completed", "status", resp.StatusCode, "duration", time.Since(start))
+			return resp, nil
+		})
+	}
+}
+
+// requestIDKey is the context key under which ContextWithRequestID stores the request ID.
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying id, RequestIDMiddleware sends it with outgoing requests made with ctx.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx by ContextWithRequestID, "" if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID returns a random 16 byte hex encoded request ID.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestIDMiddleware sets the X-Request-Id header on requests that do not have one. The ID is taken from the
+// request context (see ContextWithRequestID) so it can be propagated from an incoming request, or generated otherwise.
+func RequestIDMiddleware() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("X-Request-Id") != "" {
+				return next.RoundTrip(req)
+			}
+			id := RequestIDFromContext(req.Context())
+			if id == "" {
+				id = NewRequestID()
+			}
+			req = req.Clone(req.Context())
+			req.Header.Set("X-Request-Id", id)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// UserAgentMiddleware sets the User-Agent header of every request to userAgent.
+func UserAgentMiddleware(userAgent string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			req.Header.Set("User-Agent", userAgent)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// GzipMiddleware asks for gzip compressed responses and transparently decompresses them.
+// http.Transport already does this on its own unless a request sets Accept-Encoding itself, or it is disabled
+// with DisableCompression, this middleware makes the behaviour explicit regardless of the transport in use.
+func GzipMiddleware() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("Accept-Encoding") == "" {
+				req = req.Clone(req.Context())
+				req.Header.Set("Accept-Encoding", "gzip")
+			}
+
+			resp, err := next.RoundTrip(req)
+			if err != nil || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+				return resp, err
+			}
+
+			reader, err := gzip.NewReader(resp.Body)
+			if err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+			resp.Body = &gzipBody{reader: reader, body: resp.Body}
+			resp.Header.Del("Content-Encoding")
+			resp.Header.Del("Content-Length")
+			resp.ContentLength = -1
+			resp.Uncompressed = true
+			return resp, nil
+		})
+	}
+}
+
+// gzipBody decompresses a response body and closes both the gzip reader and the underlying body.
+type gzipBody struct {
+	reader *gzip.Reader
+	body   io.ReadCloser
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	return b.reader.Read(p)
+}
+
+func (b *gzipBody) Close() error {
+	_ = b.reader.Close()
+	return b.body.Close()
+}
+
+// sensitiveHeaders are the headers whose values DebugDumpMiddleware redacts.
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "X-Auth-Token"}
+
+// DebugDumpMiddleware writes every request and response, including bodies, to w with credentials redacted.
+// It buffers bodies in memory and is meant for debugging only.
+func DebugDumpMiddleware(w io.Writer) Middleware {
+	var mu sync.Mutex
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			reqDump, err := httputil.DumpRequestOut(req, true)
+			if err != nil {
+				return nil, err
+			}
+
+			resp, err := next.RoundTrip(req)
+
+			var respDump []byte
+			if err == nil {
+				respDump, err = httputil.DumpResponse(resp, true)
+				if err != nil {
+					resp.Body.Close()
+					return nil, err
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Fprintf(w, "--> %s\n%s\n", redactURL(req.URL), redactDump(reqDump, req.URL.RawQuery))
+			if err != nil {
+				fmt.Fprintf(w, "<-- error: %v\n\n", err)
+				return nil, err
+			}
+			fmt.Fprintf(w, "<-- %s\n%s\n\n", resp.Status, redactDump(respDump, ""))
+			return resp, nil
+		})
+	}
+}
+
+// sensitiveHeaderLine matches the header lines of a dump whose values must be redacted.
+var sensitiveHeaderLine = regexp.MustCompile(`(?im)^(` + strings.Join(sensitiveHeaders, "|") + `):[^\r\n]*`)
+
+// redactDump replaces the values of sensitive headers in an HTTP dump, and the raw query with its redacted form.
+func redactDump(dump []byte, rawQuery string) string {
+	out := sensitiveHeaderLine.ReplaceAllString(string(dump), "$1: xxxxx")
+	if rawQuery != "" {
+		out = strings.Replace(out, "?"+rawQuery, redactURL(&url.URL{RawQuery: rawQuery}), 1)
+	}
+	return out
+}
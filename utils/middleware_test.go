@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+	base := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		order = append(order, "base")
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+	if _, err := Chain(base, mark("outer"), mark("inner")).RoundTrip(req); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if strings.Join(order, ",") != "outer,inner,base" {
+		t.Errorf("Expected outer,inner,base got %v", order)
+	}
+}
+
+func TestHeaderMiddlewares(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ua": "` + r.UserAgent() + `", "id": "` + r.Header.Get("X-Request-Id") + `"}`))
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "", WithMiddleware(UserAgentMiddleware("gocore-test/1.0"), RequestIDMiddleware()))
+	if apiClient.Client == http.DefaultClient || http.DefaultClient.Transport != nil {
+		t.Fatalf("Expected http.DefaultClient to be left untouched")
+	}
+
+	ctx := ContextWithRequestID(context.Background(), "propagated-id")
+	resp, err := Get[map[string]string](ctx, &apiClient, "/")
+	if err != nil {
+		t.Fatalf("Error making GET request: %v", err)
+	}
+	if resp["ua"] != "gocore-test/1.0" || resp["id"] != "propagated-id" {
+		t.Errorf("Unexpected headers seen by server %v", resp)
+	}
+
+	resp, _ = Get[map[string]string](context.Background(), &apiClient, "/")
+	if len(resp["id"]) != 32 {
+		t.Errorf("Expected a generated request ID, got %q", resp["id"])
+	}
+}
+
+func TestGzipMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			_, _ = w.Write([]byte(`{"compressed": false}`))
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		_, _ = gz.Write([]byte(`{"compressed": true}`))
+		_ = gz.Close()
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "", WithMiddleware(GzipMiddleware()))
+	resp, err := Get[map[string]bool](context.Background(), &apiClient, "/")
+	if err != nil || !resp["compressed"] {
+		t.Errorf("Expected decompressed gzip response, got %v, %v", resp, err)
+	}
+}
+
+func TestDebugDumpMiddlewareRedacts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"hello": "world"}`))
+	}))
+	defer server.Close()
+
+	dump := &bytes.Buffer{}
+	apiClient := NewAPIClient(server.URL, "super-secret-token", WithMiddleware(DebugDumpMiddleware(dump)))
+	if _, err := Get[map[string]string](context.Background(), &apiClient, "/items?api_key=also-secret&page=2"); err != nil {
+		t.Fatalf("Error making GET request: %v", err)
+	}
+
+	out := dump.String()
+	if strings.Contains(out, "super-secret-token") || strings.Contains(out, "also-secret") {
+		t.Errorf("Expected credentials to be redacted, got:\n%s", out)
+	}
+	if !strings.Contains(out, "Authorization: xxxxx") || !strings.Contains(out, `{"hello": "world"}`) || !strings.Contains(out, "page=2") {
+		t.Errorf("Expected dump to contain the redacted request and the response, got:\n%s", out)
+	}
+}
@@ -0,0 +1,103 @@
+package utils
+
+import "net/http"
+
+// ClientOption configures an AuthenticatedAPIClient when passed to NewAPIClient or NewAPIClientWithAuth.
+type ClientOption func(c *AuthenticatedAPIClient)
+
+// apply runs opts against the client in order.
+func (c *AuthenticatedAPIClient) apply(opts []ClientOption) {
+	for _, opt := range opts {
+		opt(c)
+	}
+}
+
+// WithHTTPClient makes the client send requests using client instead of http.DefaultClient.
+// Pass it before WithMiddleware, which wraps whatever transport the client has at that point.
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(c *AuthenticatedAPIClient) {
+		c.Client = client
+	}
+}
+
+// WithMiddleware wraps the transport of the client's http.Client in middlewares, the first one being the outermost.
+// The http.Client is copied first, so a shared client such as http.DefaultClient is never modified.
+func WithMiddleware(middlewares ...Middleware) ClientOption {
+	return func(c *AuthenticatedAPIClient) {
+		client := http.Client{}
+		if c.Client != nil {
+			client = *c.Client
+		}
+		client.Transport = Chain(client.Transport, middlewares...)
+		c.Client = &client
+	}
+}
+
+// WithRetry sets the policy used to retry failed requests.
+func WithRetry(policy *RetryPolicy) ClientOption {
+	return func(c *AuthenticatedAPIClient) {
+		c.Retry = policy
+	}
+}
+
+// WithLimiter sets the limiter used to throttle requests.
+func WithLimiter(limiter *RateLimiter) ClientOption {
+	return func(c *AuthenticatedAPIClient) {
+		c.Limiter = limiter
+	}
+}
+
+// WithAuth sets the Authenticator used to authenticate requests, it takes precedence over the token.
+func WithAuth(auth Authenticator) ClientOption {
+	return func(c *AuthenticatedAPIClient) {
+		c.Auth = auth
+	}
+}
+
+// WithCache sets the cache GET responses are served from, cache hits bypass the circuit breaker and the rate limiter.
+func WithCache(cache *ResponseCache) ClientOption {
+	return func(c *AuthenticatedAPIClient) {
+		c.Cache = cache
+	}
+}
+
+// WithBreaker sets the circuit breaker guarding the upstream.
+func WithBreaker(breaker *CircuitBreaker) ClientOption {
+	return func(c *AuthenticatedAPIClient) {
+		c.Breaker = breaker
+	}
+}
+
+// WithBodyPolicy sets which methods may carry a request body.
+func WithBodyPolicy(policy BodyPolicy) ClientOption {
+	return func(c *AuthenticatedAPIClient) {
+		c.BodyPolicy = policy
+	}
+}
+
+// WithTelemetry traces requests and records their metrics, see TelemetryMiddleware.
+func WithTelemetry(cfg TelemetryConfig) ClientOption {
+	return WithMiddleware(TelemetryMiddleware(cfg))
+}
+
+// WithIdempotencyKeys makes the client send an Idempotency-Key header with every mutating request, set
+// RetryPolicy.TrustIdempotencyKey as well for such requests to be retried.
+func WithIdempotencyKeys() ClientOption {
+	return func(c *AuthenticatedAPIClient) {
+		c.IdempotencyKeys = true
+	}
+}
+
+// WithMaxResponseSize caps the size of response bodies at n bytes.
+func WithMaxResponseSize(n int64) ClientOption {
+	return func(c *AuthenticatedAPIClient) {
+		c.MaxResponseSize = n
+	}
+}
+
+// WithJSONOptions selects strict decoding of JSON response bodies.
+func WithJSONOptions(opts JSONOptions) ClientOption {
+	return func(c *AuthenticatedAPIClient) {
+		c.JSON = opts
+	}
+}
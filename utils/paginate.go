@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"strconv"
+)
+
+// PageOptions describes how a paged list endpoint is walked by Paginate.
+type PageOptions struct {
+	// PerPage is sent as the per page parameter, 0 leaves it to the server's default.
+	PerPage int
+	// PageParam is the name of the page number query parameter, "page" when empty.
+	PageParam string
+	// PerPageParam is the name of the page size query parameter, "per_page" when empty.
+	PerPageParam string
+	// TotalPagesHeader is the response header holding the number of pages, "X-Pagination-Total-Pages" (as sent by Vikunja) when empty.
+	// Without it pages are fetched until an empty one is returned.
+	TotalPagesHeader string
+	// Prefetch is how many pages are fetched concurrently ahead of the consumer, it only applies once the number of pages is known.
+	Prefetch int
+}
+
+// pageResult is a fetched page together with the number of pages reported by the server, 0 if unknown.
+type pageResult[T any] struct {
+	items      []T
+	totalPages int
+	err        error
+}
+
+// Paginate lazily walks the pages of a list endpoint starting at page 1, yielding one item at a time.
+// It stops at the last page reported by the server, or the first empty page, and stops early when the
+// consumer breaks out of the loop. A failed request is yielded as an error and ends the iteration.
+func Paginate[T any](ctx context.Context, c *AuthenticatedAPIClient, endpoint Endpoint, opts PageOptions) iter.Seq2[T, error] {
+	if opts.PageParam == "" {
+		opts.PageParam = "page"
+	}
+	if opts.PerPageParam == "" {
+		opts.PerPageParam = "per_page"
+	}
+	if opts.TotalPagesHeader == "" {
+		opts.TotalPagesHeader = "X-Pagination-Total-Pages"
+	}
+
+	fetch := func(ctx context.Context, page int) pageResult[T] {
+		pageEndpoint := endpoint.With(opts.PageParam, page)
+		if opts.PerPage > 0 {
+			pageEndpoint = pageEndpoint.With(opts.PerPageParam, opts.PerPage)
+		}
+
+		var items []T
+		header, err := c.doRequest(ctx, http.MethodGet, pageEndpoint.String(), nil, &items)
+		if err != nil {
+			return pageResult[T]{err: err}
+		}
+		totalPages, _ := strconv.Atoi(header.Get(opts.TotalPagesHeader))
+		return pageResult[T]{items: items, totalPages: totalPages}
+	}
+
+	return func(yield func(T, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		// Cancelling aborts prefetches still in flight when the consumer stops early.
+		defer cancel()
+
+		var zero T
+		pending := map[int]chan pageResult[T]{}
+		totalPages := 0
+		nextPrefetch := 2
+
+		for page := 1; totalPages == 0 || page <= totalPages; page++ {
+			var result pageResult[T]
+			if ch, ok := pending[page]; ok {
+				result = <-ch
+				delete(pending, page)
+			} else {
+				result = fetch(ctx, page)
+			}
+			if result.err != nil {
+				yield(zero, result.err)
+				return
+			}
+			if len(result.items) == 0 {
+				return
+			}
+			if result.totalPages > 0 {
+				totalPages = result.totalPages
+			}
+
+			// Keep up to Prefetch pages in flight ahead of the one being consumed.
+			nextPrefetch = max(nextPrefetch, page+1)
+			for totalPages > 0 && nextPrefetch <= min(page+opts.Prefetch, totalPages) {
+				ch := make(chan pageResult[T], 1)
+				pending[nextPrefetch] = ch
+				go func(page int) { ch <- fetch(ctx, page) }(nextPrefetch)
+				nextPrefetch++
+			}
+
+			for _, item := range result.items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// CollectAll drains seq into a slice, returning the first error it yields.
+func CollectAll[T any](seq iter.Seq2[T, error]) ([]T, error) {
+	items := []T{}
+	for item, err := range seq {
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
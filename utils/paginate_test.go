@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// pagedServer serves items 1..total in pages of perPage, counting the requests it receives.
+func pagedServer(total, perPage int, withHeader bool, calls *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if withHeader {
+			w.Header().Set("X-Pagination-Total-Pages", strconv.Itoa((total+perPage-1)/perPage))
+		}
+		items := []int{}
+		for i := (page-1)*perPage + 1; i <= min(page*perPage, total); i++ {
+			items = append(items, i)
+		}
+		_ = json.NewEncoder(w).Encode(items)
+	}))
+}
+
+func TestPaginateUsesTotalPagesHeader(t *testing.T) {
+	for _, prefetch := range []int{0, 3} {
+		var calls atomic.Int32
+		server := pagedServer(10, 3, true, &calls)
+
+		apiClient := NewAPIClient(server.URL, "")
+		items, err := CollectAll(Paginate[int](context.Background(), &apiClient, NewEndpoint("items"), PageOptions{PerPage: 3, Prefetch: prefetch}))
+		server.Close()
+
+		if err != nil {
+			t.Fatalf("Error paginating: %v", err)
+		}
+		if len(items) != 10 || items[0] != 1 || items[9] != 10 {
+			t.Errorf("Expected items 1..10 in order, got %v", items)
+		}
+		if calls.Load() != 4 {
+			t.Errorf("Expected 4 page requests with prefetch %d, got %d", prefetch, calls.Load())
+		}
+	}
+}
+
+func TestPaginateWithoutHeaderStopsAtEmptyPage(t *testing.T) {
+	var calls atomic.Int32
+	server := pagedServer(4, 2, false, &calls)
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "")
+	items, err := CollectAll(Paginate[int](context.Background(), &apiClient, NewEndpoint("items"), PageOptions{PerPage: 2}))
+	if err != nil || len(items) != 4 {
+		t.Fatalf("Expected 4 items, got %v, %v", items, err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected 2 pages and a final empty one, got %d requests", calls.Load())
+	}
+}
+
+func TestPaginateStopsWhenConsumerBreaks(t *testing.T) {
+	var calls atomic.Int32
+	server := pagedServer(100, 5, true, &calls)
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "")
+	seen := 0
+	for item, err := range Paginate[int](context.Background(), &apiClient, NewEndpoint("items"), PageOptions{PerPage: 5}) {
+		if err != nil {
+			t.Fatalf("Error paginating: %v", err)
+		}
+		seen++
+		if item == 7 {
+			break
+		}
+	}
+	if seen != 7 || calls.Load() != 2 {
+		t.Errorf("Expected to stop after 7 items and 2 pages, got %d items and %d pages", seen, calls.Load())
+	}
+}
+
+func TestPaginateYieldsErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "")
+	_, err := CollectAll(Paginate[int](context.Background(), &apiClient, NewEndpoint("items"), PageOptions{}))
+	if !IsUnauthorized(err) {
+		t.Errorf("Expected a 401 APIError, got %v", err)
+	}
+}
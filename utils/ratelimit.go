@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateLimiter throttles the requests made by every AuthenticatedAPIClient sharing it, using a token bucket
+// to limit the request rate and a semaphore to cap the number of requests in flight. It is safe for concurrent use.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+	slots chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	requests      atomic.Int64
+	throttled     atomic.Int64
+	throttledTime atomic.Int64
+}
+
+// RateLimiterStats is a snapshot of how much a RateLimiter has throttled requests.
+type RateLimiterStats struct {
+	// Requests is the number of requests that went through the limiter.
+	Requests int64
+	// Throttled is the number of requests that had to wait for a token or an in-flight slot.
+	Throttled int64
+	// ThrottledTime is the total time requests spent waiting.
+	ThrottledTime time.Duration
+	// InFlight is the number of requests currently holding an in-flight slot.
+	InFlight int
+}
+
+// NewRateLimiter creates a RateLimiter allowing rate requests per second with bursts of up to burst requests
+// and at most maxInFlight concurrent requests. A rate or maxInFlight of 0 or less disables that limit.
+func NewRateLimiter(rate float64, burst, maxInFlight int) *RateLimiter {
+	l := &RateLimiter{
+		rate:   rate,
+		burst:  float64(max(burst, 1)),
+		last:   time.Now(),
+		tokens: float64(max(burst, 1)),
+	}
+	if maxInFlight > 0 {
+		l.slots = make(chan struct{}, maxInFlight)
+	}
+	return l
+}
+
+// Stats returns how much the limiter has throttled requests so far.
+func (l *RateLimiter) Stats() RateLimiterStats {
+	return RateLimiterStats{
+		Requests:      l.requests.Load(),
+		Throttled:     l.throttled.Load(),
+		ThrottledTime: time.Duration(l.throttledTime.Load()),
+		InFlight:      len(l.slots),
+	}
+}
+
+// acquire takes an in-flight slot, waiting until one is free or ctx is done. The returned function releases the slot.
+func (l *RateLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil || l.slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.release, nil
+	default:
+	}
+
+	start := time.Now()
+	defer l.recordThrottle(start)
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// release frees an in-flight slot taken by acquire.
+func (l *RateLimiter) release() {
+	<-l.slots
+}
+
+// wait takes a token from the bucket, waiting until one is available or ctx is done.
+func (l *RateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.requests.Add(1)
+	if l.rate <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	// The token is reserved right away, so concurrent waiters queue up behind each other instead of racing.
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	start := time.Now()
+	defer l.recordThrottle(start)
+
+	if err := sleepContext(ctx, delay); err != nil {
+		// Hand the reservation back, the request is not going to be made.
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// recordThrottle records a request that was throttled since start.
+func (l *RateLimiter) recordThrottle(start time.Time) {
+	l.throttled.Add(1)
+	l.throttledTime.Add(int64(time.Since(start)))
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterThrottlesRate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "")
+	apiClient.Limiter = NewRateLimiter(50, 1, 0)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := Get[map[string]interface{}](context.Background(), &apiClient, "/"); err != nil {
+			t.Fatalf("Error making GET request: %v", err)
+		}
+	}
+
+	// The first request uses the burst, the other 4 wait 20ms each.
+	if elapsed := time.Since(start); elapsed < 70*time.Millisecond {
+		t.Errorf("Expected requests to be throttled to 50/s, 5 requests took %v", elapsed)
+	}
+	stats := apiClient.Limiter.Stats()
+	if stats.Requests != 5 || stats.Throttled != 4 || stats.ThrottledTime <= 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestRateLimiterCapsInFlight(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "")
+	apiClient.Limiter = NewRateLimiter(0, 0, 2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = Get[map[string]interface{}](context.Background(), &apiClient, "/")
+		}()
+	}
+	wg.Wait()
+
+	if peak.Load() > 2 {
+		t.Errorf("Expected at most 2 requests in flight, saw %d", peak.Load())
+	}
+	if apiClient.Limiter.Stats().InFlight != 0 {
+		t.Errorf("Expected all in-flight slots to be released")
+	}
+}
+
+func TestRateLimiterWaitHonoursContext(t *testing.T) {
+	limiter := NewRateLimiter(1, 1, 0)
+	if err := limiter.wait(context.Background()); err != nil {
+		t.Fatalf("Expected first token to be available, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy describes when and how often AuthenticatedAPIClient retries a failed request.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first one, values below 2 disable retrying.
+	MaxAttempts int
+	// InitialBackoff is the delay before the second attempt, each further attempt multiplies it by Multiplier.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the computed backoff, delays requested by the server via Retry-After are capped by MaxRetryAfter.
+	MaxBackoff time.Duration
+	// MaxRetryAfter is the longest Retry-After delay waited for, a longer one ends the retries and returns the
+	// response instead of blocking the caller. 0 means MaxBackoff.
+	MaxRetryAfter time.Duration
+	// Multiplier is the factor the backoff grows by between attempts, values below 1 are treated as 1.
+	Multiplier float64
+	// Jitter is the fraction (0 to 1) of the backoff that is randomised to avoid synchronised retries.
+	Jitter float64
+	// RetryableStatusCodes are the response status codes that trigger a retry.
+	RetryableStatusCodes []int
+	// RetryNetworkErrors enables retrying when no response was received at all (connection refused, reset, etc.).
+	RetryNetworkErrors bool
+	// IdempotentMethods are the methods that are safe to repeat, nil means GET, HEAD, OPTIONS, TRACE, PUT and DELETE.
+	// Leave PUT out for APIs such as Vikunja's that create resources with it.
+	IdempotentMethods []string
+	// RetryNonIdempotent allows retrying methods not in IdempotentMethods, which may otherwise apply the same change twice.
+	RetryNonIdempotent bool
+	// TrustIdempotencyKey also retries those methods when the request carries an Idempotency-Key header.
+	// Only enable it for servers that honour the header, Vikunja does not.
+	TrustIdempotencyKey bool
+}
+
+// DefaultRetryPolicy returns a policy making up to 3 attempts with exponential backoff on network errors,
+// 429 and the 502/503/504 family of statuses typically returned by reverse proxies.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:          3,
+		InitialBackoff:       200 * time.Millisecond,
+		MaxBackoff:           5 * time.Second,
+		MaxRetryAfter:        30 * time.Second,
+		Multiplier:           2,
+		Jitter:               0.2,
+		RetryableStatusCodes: []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		RetryNetworkErrors:   true,
+	}
+}
+
+// defaultIdempotentMethods are the methods HTTP defines as idempotent, used when IdempotentMethods is nil.
+var defaultIdempotentMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete}
+
+// isIdempotent reports whether repeating a request with the given method has the same effect as making it once.
+func (p *RetryPolicy) isIdempotent(method string) bool {
+	methods := p.IdempotentMethods
+	if methods == nil {
+		methods = defaultIdempotentMethods
+	}
+	return slices.Contains(methods, method)
+}
+
+// trustsKeyOf reports whether req carries an Idempotency-Key the server is trusted to recognise repeated requests by.
+func (p *RetryPolicy) trustsKeyOf(req *http.Request) bool {
+	return p.TrustIdempotencyKey && req.Header.Get(IdempotencyKeyHeader) != ""
+}
+
+// canRetry reports whether the policy permits retrying req at all.
+func (p *RetryPolicy) canRetry(req *http.Request) bool {
+	if p == nil || p.MaxAttempts < 2 {
+		return false
+	}
+	if !p.RetryNonIdempotent && !p.isIdempotent(req.Method) && !p.trustsKeyOf(req) {
+		return false
+	}
+	// A body that cannot be rewound cannot be sent a second time.
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	return true
+}
+
+// shouldRetry reports whether the outcome of an attempt is retryable.
+func (p *RetryPolicy) shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		// Cancellation is the caller giving up, not a transient failure.
+		return p.RetryNetworkErrors && ctx.Err() == nil
+	}
+
+	return ArrContains(p.RetryableStatusCodes, resp.StatusCode)
+}
+
+// backoff returns the delay to wait after the given (1-based) failed attempt, false if the server asked to wait
+// longer than MaxRetryAfter.
+func (p *RetryPolicy) backoff(attempt int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			limit := p.MaxRetryAfter
+			if limit == 0 {
+				limit = p.MaxBackoff
+			}
+			return delay, limit <= 0 || delay <= limit
+		}
+	}
+
+	multiplier := math.Max(p.Multiplier, 1)
+	delay := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 {
+		delay = math.Min(delay, float64(p.MaxBackoff))
+	}
+	if jitter := math.Min(math.Max(p.Jitter, 0), 1); jitter > 0 {
+		delay *= 1 - jitter + 2*jitter*rand.Float64()
+	}
+
+	return time.Duration(delay), true
+}
+
+// parseRetryAfter parses a Retry-After header value given either in seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// send performs req using the underlying http.Client, retrying according to the client's RetryPolicy.
+// Every attempt takes a token from the client's RateLimiter.
+func (c *AuthenticatedAPIClient) send(req *http.Request) (*http.Response, error) {
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	ctx := req.Context()
+	policy := c.Retry
+	if !policy.canRetry(req) {
+		if err := c.Limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+		return client.Do(req)
+	}
+
+	l := slog.Default().With("method", req.Method, "host", req.URL.Host, "path", req.URL.Path)
+
+	for attempt := 1; ; attempt++ {
+		attemptReq := req
+		if attempt > 1 {
+			attemptReq = req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				attemptReq.Body = body
+			}
+		}
+
+		if err := c.Limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(attemptReq)
+		if attempt >= policy.MaxAttempts || !policy.shouldRetry(ctx, resp, err) {
+			return resp, err
+		}
+
+		delay, ok := policy.backoff(attempt, resp)
+		if !ok {
+			l.Warn("API asked to retry later than the policy waits, giving up", "status", resp.StatusCode, "retryAfter", delay)
+			return resp, nil
+		}
+		attemptLog := l.With("attempt", attempt, "maxAttempts", policy.MaxAttempts, "delay", delay)
+		if err != nil {
+			attemptLog.Warn("API request failed, retrying", "error", err)
+		} else {
+			attemptLog.Warn("API request returned retryable status, retrying", "status", resp.StatusCode)
+			// Drain the body so the connection can be reused for the next attempt.
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testRetryPolicy() *RetryPolicy {
+	policy := DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	policy.MaxBackoff = 5 * time.Millisecond
+	return policy
+}
+
+func TestRetryOnBadGateway(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok": true}`))
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "")
+	apiClient.Retry = testRetryPolicy()
+
+	resp := map[string]interface{}{}
+	if err := apiClient.GetWithContext(context.Background(), "/flaky", &resp); err != nil {
+		t.Fatalf("Expected request to succeed after retries, got %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls.Load())
+	}
+	if resp["ok"] != true {
+		t.Errorf("Expected decoded response from final attempt, got %v", resp)
+	}
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "")
+	apiClient.Retry = testRetryPolicy()
+
+	resp := map[string]interface{}{}
+	err := apiClient.GetWithContext(context.Background(), "/down", &resp)
+	if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected APIError with status 503, got %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls.Load())
+	}
+}
+
+func TestRetrySkipsNonIdempotentMethods(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "")
+	apiClient.Retry = testRetryPolicy()
+
+	resp := map[string]interface{}{}
+	_ = apiClient.PostWithContext(context.Background(), "/create", map[string]string{"a": "b"}, &resp)
+	if calls.Load() != 1 {
+		t.Errorf("Expected POST to be attempted once, got %d", calls.Load())
+	}
+
+	calls.Store(0)
+	apiClient.Retry.RetryNonIdempotent = true
+	_ = apiClient.PostWithContext(context.Background(), "/create", map[string]string{"a": "b"}, &resp)
+	if calls.Load() != 3 {
+		t.Errorf("Expected POST to be retried when explicitly allowed, got %d attempts", calls.Load())
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"-1", 0, false},
+		{"Mon, 01 Jan 2024 12:00:10 GMT", 10 * time.Second, true},
+		{"Mon, 01 Jan 2024 11:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+
+	for _, c := range cases {
+		delay, ok := parseRetryAfter(c.value, now)
+		if delay != c.expected || ok != c.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; expected %v, %v", c.value, delay, ok, c.expected, c.ok)
+		}
+	}
+}
+
+func TestRetryAfterAboveLimitIsNotWaitedFor(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", r.URL.Query().Get("after"))
+		calls.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "", WithRetry(testRetryPolicy()))
+	for after, expected := range map[string]int32{"3600": 1, "0": 3} {
+		calls.Store(0)
+		start := time.Now()
+		err := apiClient.GetWithContext(context.Background(), "/limited?after="+after, &map[string]interface{}{})
+		if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("Expected APIError with status 429 for Retry-After %s, got %v", after, err)
+		}
+		if calls.Load() != expected || time.Since(start) > time.Second {
+			t.Errorf("Expected %d attempts for Retry-After %s, got %d in %s", expected, after, calls.Load(), time.Since(start))
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultGracePeriod is how long a Server waits for in-flight requests when shutting down, it fits in the
+// 30 second termination grace period Kubernetes gives a pod by default.
+const DefaultGracePeriod = 25 * time.Second
+
+// ShutdownHookTimeout is how long shutdown hooks get when draining requests used up the whole grace period,
+// together with DefaultGracePeriod it fits in the Kubernetes termination grace period.
+const ShutdownHookTimeout = 5 * time.Second
+
+// ErrServerStarted is returned by Start when the server is already running or was shut down.
+var ErrServerStarted = errors.New("server already started")
+
+// Server is an HTTP server that shuts down gracefully, draining in-flight requests before running its shutdown hooks.
+type Server struct {
+	// Addr is the TCP address to listen on, e.g. ":8080". ":0" picks a free port, see ListenAddr.
+	Addr    string
+	Handler http.Handler
+	// GracePeriod is how long Run waits for in-flight requests and shutdown hooks, DefaultGracePeriod when 0.
+	GracePeriod time.Duration
+
+	mu       sync.Mutex
+	srv      *http.Server
+	listener net.Listener
+	// serveErr receives the error the server stopped with, http.ErrServerClosed excluded.
+	serveErr chan error
+	// cancelRequests cancels the context of every request, it is called when the grace period runs out.
+	cancelRequests context.CancelFunc
+	hooks          []func(ctx context.Context) error
+	// shutdownDone is closed once the first Shutdown returned, shutdownErr being its result.
+	shutdownDone chan struct{}
+	shutdownErr  error
+}
+
+// NewServer creates a Server listening on addr and serving handler.
+func NewServer(addr string, handler http.Handler) *Server {
+	return &Server{Addr: addr, Handler: handler}
+}
+
+// OnShutdown registers hook to run during Shutdown once in-flight requests drained, e.g. to flush telemetry.
+// Hooks run in the order they were registered and get the remainder of the grace period, or ShutdownHookTimeout
+// if draining used it all up.
+func (s *Server) OnShutdown(hook func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, hook)
+}
+
+// Start listens on Addr and serves requests in the background. An error to listen, e.g. the port being taken,
+// is returned right away instead of exiting the process.
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.srv != nil {
+		return ErrServerStarted
+	}
+
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+
+	baseCtx, cancel := context.WithCancel(context.Background())
+	s.srv = &http.Server{
+		Handler:           s.Handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return baseCtx },
+	}
+	s.listener = listener
+	s.cancelRequests = cancel
+	s.serveErr = make(chan error, 1)
+
+	srv, serveErr := s.srv, s.serveErr
+	go func() {
+		if err := srv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+		close(serveErr)
+	}()
+
+	slog.Default().Info("Started API server", "addr", listener.Addr().String())
+	return nil
+}
+
+// ListenAddr returns the address the server listens on, nil before Start.
+func (s *Server) ListenAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Shutdown stops accepting connections, waits for in-flight requests until ctx is done and runs the shutdown hooks.
+// Requests still running when ctx is done have their context cancelled and their connections closed.
+// Errors of the drain and of every hook are joined together. Only the first call shuts the server down, later ones
+// wait for it to finish, or for their ctx to be done, and return its result.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if done := s.shutdownDone; done != nil {
+		s.mu.Unlock()
+		select {
+		case <-done:
+			return s.shutdownErr
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	done := make(chan struct{})
+	s.shutdownDone = done
+	srv, cancelRequests, hooks := s.srv, s.cancelRequests, s.hooks
+	s.mu.Unlock()
+
+	var errs []error
+	if srv != nil {
+		if err := srv.Shutdown(ctx); err != nil {
+			slog.Default().Warn("Grace period ran out, aborting in-flight requests", "error", err)
+			errs = append(errs, err)
+			cancelRequests()
+			_ = srv.Close()
+		}
+		cancelRequests()
+	}
+
+	hookCtx := ctx
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		hookCtx, cancel = context.WithTimeout(context.WithoutCancel(ctx), ShutdownHookTimeout)
+		defer cancel()
+	}
+	for _, hook := range hooks {
+		if err := hook(hookCtx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	s.shutdownErr = errors.Join(errs...)
+	close(done)
+	return s.shutdownErr
+}
+
+// Run starts the server and blocks until ctx is done, SIGINT or SIGTERM is received or the server fails,
+// then shuts it down within GracePeriod. It returns nil after a clean shutdown.
+func (s *Server) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := s.Start(); err != nil {
+		return err
+	}
+
+	var serveErr error
+	var failed bool
+	select {
+	case <-ctx.Done():
+		slog.Default().Info("Shutting down API server", "reason", context.Cause(ctx))
+	case serveErr, failed = <-s.serveErr:
+		// The channel is closed without an error when Shutdown was called elsewhere.
+		if failed {
+			slog.Default().Error("API server failed", "error", serveErr)
+		}
+	}
+
+	gracePeriod := s.GracePeriod
+	if gracePeriod == 0 {
+		gracePeriod = DefaultGracePeriod
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), gracePeriod)
+	defer cancel()
+
+	return errors.Join(serveErr, s.Shutdown(shutdownCtx))
+}
@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	sloghttp "github.com/samber/slog-http"
+)
+
+// Router is what packages register their routes on, *http.ServeMux and *ServerBuilder implement it.
+// Patterns use the Go 1.22 syntax, e.g. "POST /webhooks/{project}".
+type Router interface {
+	Handle(pattern string, handler http.Handler)
+	HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request))
+}
+
+// ServerMiddleware wraps an http.Handler, e.g. to authenticate requests.
+type ServerMiddleware func(next http.Handler) http.Handler
+
+// ServerBuilder assembles a Server from routes registered on a ServeMux of its own, so several servers can
+// run in one process and no handler leaks into http.DefaultServeMux.
+type ServerBuilder struct {
+	mux *http.ServeMux
+	// builtins are the patterns of the probe and metrics routes, which the middlewares do not wrap.
+	builtins    map[string]bool
+	health      *HealthRegistry
+	metrics     *MetricsRegistry
+	middlewares []ServerMiddleware
+	logger      *slog.Logger
+}
+
+// NewServerBuilder creates a ServerBuilder whose ServeMux only serves the Kubernetes probe endpoints
+// /healthz, /readyz and /livez, see Health, and the Prometheus endpoint /metrics, see SetMetrics.
+// Requests are logged and recovered from panics using slog.Default().
+func NewServerBuilder() *ServerBuilder {
+	return newServerBuilder(nil)
+}
+
+// newServerBuilder is NewServerBuilder leaving out the built-in routes legacy already serves, so mounting legacy
+// at "/" keeps its own handlers for those paths.
+func newServerBuilder(legacy *http.ServeMux) *ServerBuilder {
+	b := &ServerBuilder{
+		mux:      http.NewServeMux(),
+		builtins: map[string]bool{},
+		health:   NewHealthRegistry(),
+		metrics:  DefaultMetrics,
+		logger:   slog.Default(),
+	}
+	builtins := []struct {
+		pattern string
+		handler http.Handler
+	}{
+		{"GET /healthz", b.health.Handler(false)},
+		{"GET /readyz", b.health.Handler(false)},
+		{"GET /livez", b.health.Handler(true)},
+		{"GET /metrics", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b.metrics.Handler().ServeHTTP(w, r)
+		})},
+	}
+	for _, builtin := range builtins {
+		if legacy != nil && serves(legacy, builtin.pattern) {
+			continue
+		}
+		b.mux.Handle(builtin.pattern, builtin.handler)
+		b.builtins[builtin.pattern] = true
+	}
+	return b
+}
+
+// serves reports whether mux routes requests matching a "METHOD /path" pattern to a handler of its own.
+func serves(mux *http.ServeMux, pattern string) bool {
+	method, path, _ := strings.Cut(pattern, " ")
+	req, err := http.NewRequest(method, path, nil)
+	if err != nil {
+		return false
+	}
+	_, matched := mux.Handler(req)
+	return matched != ""
+}
+
+// SetMetrics makes the server record its request metrics on metrics and serve it on /metrics instead of DefaultMetrics.
+// Call it before Handler or Build.
+func (b *ServerBuilder) SetMetrics(metrics *MetricsRegistry) {
+	b.metrics = metrics
+}
+
+// Metrics returns the registry the server records its request metrics on and serves on /metrics, packages
+// registering routes on the builder record their own metrics on it too.
+func (b *ServerBuilder) Metrics() *MetricsRegistry {
+	return b.metrics
+}
+
+// Health returns the registry of the checks served on the probe endpoints.
+func (b *ServerBuilder) Health() *HealthRegistry {
+	return b.health
+}
+
+// Handle registers handler for pattern, it panics on an invalid or conflicting pattern like http.ServeMux.
+func (b *ServerBuilder) Handle(pattern string, handler http.Handler) {
+	b.mux.Handle(pattern, handler)
+}
+
+// HandleFunc registers handler for pattern, it panics on an invalid or conflicting pattern like http.ServeMux.
+func (b *ServerBuilder) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	b.mux.HandleFunc(pattern, handler)
+}
+
+// Use adds middlewares wrapping every registered route, the first one being the outermost, e.g. RequestIDHandler
+// or CORS. They run inside the request logging and panic recovery. The probe and metrics endpoints are left out, so
+// the kubelet and Prometheus keep reaching them; still, authentication is best applied per route, e.g.
+// b.Handle("POST /webhook", RequireBearerToken(token)(handler)).
+func (b *ServerBuilder) Use(middlewares ...ServerMiddleware) {
+	b.middlewares = append(b.middlewares, middlewares...)
+}
+
+// Handler returns the ServeMux wrapped in the middlewares, request metrics, request logging and panic recovery.
+func (b *ServerBuilder) Handler() http.Handler {
+	var routes http.Handler = b.mux
+	for i := len(b.middlewares) - 1; i >= 0; i-- {
+		routes = b.middlewares[i](routes)
+	}
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := b.mux.Handler(r); b.builtins[pattern] {
+			b.mux.ServeHTTP(w, r)
+			return
+		}
+		routes.ServeHTTP(w, r)
+	})
+	handler = b.instrument(handler)
+	handler = sloghttp.Recovery(handler)
+	return sloghttp.New(b.logger)(handler)
+}
+
+// Build returns a Server listening on addr and serving the registered routes.
+func (b *ServerBuilder) Build(addr string) *Server {
+	return NewServer(addr, b.Handler())
+}
+
+// instrument records the count, duration and in-flight number of requests per route on the builder's metrics.
+// The route is the matched ServeMux pattern, so path parameters do not blow up the number of series.
+func (b *ServerBuilder) instrument(next http.Handler) http.Handler {
+	requests := b.metrics.Counter("http_server_requests_total", "Requests served, by route and status code.", "method", "route", "code")
+	duration := b.metrics.Histogram("http_server_request_duration_seconds", "Duration of requests served, by route.", nil, "method", "route")
+	inFlight := b.metrics.Gauge("http_server_requests_in_flight", "Requests being served, by route.", "method", "route")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := b.mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		method := r.Method
+		if !isKnownMethod(method) {
+			method = "other"
+		}
+
+		start := time.Now()
+		inFlight.Inc(method, route)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			inFlight.Dec(method, route)
+			status := rec.status
+			p := recover()
+			if p != nil {
+				status = http.StatusInternalServerError
+			}
+			requests.Inc(method, route, strconv.Itoa(status))
+			duration.Observe(time.Since(start).Seconds(), method, route)
+			if p != nil {
+				panic(p)
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush a stream.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Flush passes flushes on to the underlying writer for handlers asserting http.Flusher.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		r.wroteHeader = true
+		f.Flush()
+	}
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServerBuilderRoutes(t *testing.T) {
+	b := NewServerBuilder()
+	b.HandleFunc("POST /projects/{id}/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("created for " + r.PathValue("id")))
+	})
+	b.HandleFunc("GET /panic", func(http.ResponseWriter, *http.Request) {
+		panic("handler bug")
+	})
+	b.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Middleware", "outer")
+			next.ServeHTTP(w, r)
+		})
+	})
+	server := httptest.NewServer(b.Handler())
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/projects/7/webhooks", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "created for 7" || resp.Header.Get("X-Middleware") != "outer" {
+		t.Errorf("Unexpected response %q with headers %v", body, resp.Header)
+	}
+
+	resp, err = http.Get(server.URL + "/projects/7/webhooks")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != "POST" {
+		t.Errorf("Expected 405 allowing POST, got %d allowing %q", resp.StatusCode, resp.Header.Get("Allow"))
+	}
+
+	resp, err = http.Get(server.URL + "/panic")
+	if err != nil {
+		t.Fatalf("Expected the panic to be recovered, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected 500 from a panicking handler, got %d", resp.StatusCode)
+	}
+}
+
+func TestServerBuildersAreIndependent(t *testing.T) {
+	ctx := context.Background()
+	var urls []string
+	for _, name := range []string{"first", "second"} {
+		b := NewServerBuilder()
+		b.HandleFunc("GET /name", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(name))
+		})
+		s := b.Build("127.0.0.1:0")
+		urls = append(urls, startServer(t, s))
+		defer s.Shutdown(ctx)
+	}
+
+	for i, name := range []string{"first", "second"} {
+		apiClient := NewAPIClient(urls[i], "")
+		got, err := Get[string](ctx, &apiClient, "/name")
+		if err != nil || got != name {
+			t.Errorf("Expected %q from server %d, got %q, %v", name, i, got, err)
+		}
+	}
+
+	b := NewServerBuilder()
+	b.Handle("GET /name", http.NotFoundHandler())
+	if _, pattern := http.DefaultServeMux.Handler(httptest.NewRequest(http.MethodGet, "/name", nil)); pattern != "" {
+		t.Errorf("Expected nothing to be registered on http.DefaultServeMux, got %q", pattern)
+	}
+}
+
+func TestServerBuilderKeepsLegacyRoutes(t *testing.T) {
+	legacy := http.NewServeMux()
+	legacy.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("legacy"))
+	})
+	b := newServerBuilder(legacy)
+	b.Handle("/", legacy)
+	server := httptest.NewServer(b.Handler())
+	defer server.Close()
+
+	for path, expected := range map[string]string{"/healthz": "legacy", "/livez": `{"status":"ok","checks":[]}`} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if strings.TrimSpace(string(body)) != expected {
+			t.Errorf("Expected %q from %s, got %q", expected, path, body)
+		}
+	}
+}
+
+func TestServerBuilderMiddlewaresSkipProbes(t *testing.T) {
+	b := NewServerBuilder()
+	b.SetMetrics(NewMetricsRegistry())
+	b.HandleFunc("GET /tasks", func(http.ResponseWriter, *http.Request) {})
+	b.Use(RequireBearerToken("s3cret"))
+	server := httptest.NewServer(b.Handler())
+	defer server.Close()
+
+	for path, expected := range map[string]int{
+		"/tasks":   http.StatusUnauthorized,
+		"/healthz": http.StatusOK,
+		"/readyz":  http.StatusOK,
+		"/livez":   http.StatusOK,
+		"/metrics": http.StatusOK,
+	} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			t.Errorf("Expected %d from %s without a token, got %d", expected, path, resp.StatusCode)
+		}
+	}
+}
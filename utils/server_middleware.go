@@ -0,0 +1,268 @@
+package utils
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRequestIDLength caps incoming request IDs, longer ones are replaced rather than logged.
+const maxRequestIDLength = 128
+
+// RequestIDHandler takes the request ID from the X-Request-Id header, or generates one, and echoes it in the response.
+// The ID is stored in the request context (see RequestIDFromContext), so RequestIDMiddleware forwards it to the APIs
+// the handler calls, and the context logger (see LoggerFromContext) logs it as request_id.
+func RequestIDHandler() ServerMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get("X-Request-Id")
+			if !validRequestID(id) {
+				id = NewRequestID()
+			}
+			w.Header().Set("X-Request-Id", id)
+
+			ctx := ContextWithRequestID(r.Context(), id)
+			ctx = ContextWithLogger(ctx, LoggerFromContext(ctx).With("request_id", id))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// validRequestID reports whether a client supplied request ID is safe to adopt, i.e. short and printable ASCII.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// CORSPolicy describes which cross-origin requests browsers are allowed to make.
+type CORSPolicy struct {
+	// AllowedOrigins are the origins allowed to make requests, e.g. "https://app.example.com". "*" allows any origin.
+	AllowedOrigins []string
+	// AllowedMethods are the methods allowed in preflighted requests, GET, HEAD and POST when empty.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed in preflighted requests.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts may read, e.g. X-Request-Id.
+	ExposedHeaders []string
+	// AllowCredentials lets requests carry cookies and Authorization headers, the origin is then echoed rather than "*".
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response, 0 leaves it to the browser.
+	MaxAge time.Duration
+}
+
+// CORS applies policy to cross-origin requests and answers preflight requests itself.
+// Requests from origins not allowed are passed on without CORS headers, so the browser blocks the response.
+func CORS(policy CORSPolicy) ServerMiddleware {
+	methods := policy.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	anyOrigin := slices.Contains(policy.AllowedOrigins, "*")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			w.Header().Add("Vary", "Origin")
+			if origin == "" || !(anyOrigin || slices.Contains(policy.AllowedOrigins, origin)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if anyOrigin && !policy.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if policy.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if !preflight {
+				if len(policy.ExposedHeaders) > 0 {
+					w.Header().Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			if len(policy.AllowedHeaders) > 0 {
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(policy.AllowedHeaders, ", "))
+			}
+			if policy.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// RequireBearerToken refuses requests whose Authorization header does not carry one of tokens as a Bearer token.
+func RequireBearerToken(tokens ...string) ServerMiddleware {
+	return requireAuth("Bearer", func(r *http.Request) bool {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		return ok && slices.ContainsFunc(tokens, func(t string) bool { return secureEqual(token, t) })
+	})
+}
+
+// RequireBasicAuth refuses requests whose basic auth credentials do not match users, a map of username to password.
+func RequireBasicAuth(realm string, users map[string]string) ServerMiddleware {
+	return requireAuth(fmt.Sprintf("Basic realm=%q", realm), func(r *http.Request) bool {
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			return false
+		}
+		expected, known := users[username]
+		return known && secureEqual(password, expected)
+	})
+}
+
+// RequireSharedSecret refuses requests whose header does not carry secret, e.g. a webhook secret set on the sender.
+func RequireSharedSecret(header, secret string) ServerMiddleware {
+	return requireAuth("", func(r *http.Request) bool {
+		return secureEqual(r.Header.Get(header), secret)
+	})
+}
+
+// requireAuth answers 401 Unauthorized with the given WWW-Authenticate challenge to requests authorized rejects.
+func requireAuth(challenge string, authorized func(r *http.Request) bool) ServerMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !authorized(r) {
+				LoggerFromContext(r.Context()).Warn("Rejected unauthenticated request", "path", r.URL.Path, "remoteAddr", r.RemoteAddr)
+				if challenge != "" {
+					w.Header().Set("WWW-Authenticate", challenge)
+				}
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// secureEqual compares got to expected in constant time, an empty expected value never matches.
+func secureEqual(got, expected string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(got), []byte(expected)) == 1
+}
+
+// MaxBodySize refuses request bodies larger than n bytes with 413 Request Entity Too Large.
+// A body without a Content-Length is cut off at n bytes, reading past it fails with *http.MaxBytesError.
+func MaxBodySize(n int64) ServerMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Timeout cancels the request context after d and answers 503 Service Unavailable if the handler has not finished.
+// Wrap single handlers with it, e.g. b.Handle("POST /sync", Timeout(time.Minute)(syncHandler)).
+// The response is buffered until the handler returns, so it does not suit streaming handlers.
+func Timeout(d time.Duration) ServerMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.TimeoutHandler(next, d, "request timed out")
+	}
+}
+
+// clientIPKey is the context key under which RealIP stores the client IP.
+type clientIPKey struct{}
+
+// ClientIPFromContext returns the client IP stored in ctx by RealIP, "" if there is none.
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// RealIP determines the client IP of requests reaching the server through reverse proxies, ingress controllers and
+// load balancers listed in trustedProxies as IPs or CIDR ranges such as "10.0.0.0/8". Forwarding headers are only
+// believed from trusted proxies: X-Forwarded-For is walked from the right, skipping trusted hops, falling back to
+// X-Real-IP. The client IP replaces the request's RemoteAddr and is stored in the context, see ClientIPFromContext.
+func RealIP(trustedProxies ...string) (ServerMiddleware, error) {
+	prefixes := make([]netip.Prefix, 0, len(trustedProxies))
+	for _, proxy := range trustedProxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	trusted := func(addr netip.Addr) bool {
+		addr = addr.Unmap()
+		return slices.ContainsFunc(prefixes, func(p netip.Prefix) bool { return p.Contains(addr) })
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := remoteIP(r.RemoteAddr)
+			if ip.IsValid() && trusted(ip) {
+				ip = forwardedIP(r.Header, ip, trusted)
+			}
+			if ip.IsValid() {
+				client := ip.Unmap().String()
+				r = r.WithContext(context.WithValue(r.Context(), clientIPKey{}, client))
+				r.RemoteAddr = client
+			}
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// remoteIP parses the IP of a RemoteAddr, with or without a port.
+func remoteIP(remoteAddr string) netip.Addr {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+	addr, _ := netip.ParseAddr(remoteAddr)
+	return addr
+}
+
+// forwardedIP returns the first untrusted hop of X-Forwarded-For counting from the right, or X-Real-IP,
+// peer if neither names a valid address.
+func forwardedIP(header http.Header, peer netip.Addr, trusted func(netip.Addr) bool) netip.Addr {
+	var hops []string
+	for _, value := range header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// Everything left of a malformed hop may have been forged.
+			return peer
+		}
+		if !trusted(addr) || i == 0 {
+			return addr
+		}
+	}
+
+	if addr, err := netip.ParseAddr(strings.TrimSpace(header.Get("X-Real-IP"))); err == nil {
+		return addr
+	}
+	return peer
+}
@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serve runs req through handler wrapped in mw and returns the recorded response.
+func serve(mw ServerMiddleware, handler http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	mw(handler).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRequestIDHandler(t *testing.T) {
+	logs := &bytes.Buffer{}
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(logs, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	var seen string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+		LoggerFromContext(r.Context()).Info("Handling webhook")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+	req.Header.Set("X-Request-Id", "upstream-42")
+	rec := serve(RequestIDHandler(), handler, req)
+	if seen != "upstream-42" || rec.Header().Get("X-Request-Id") != "upstream-42" {
+		t.Errorf("Expected the incoming ID to be propagated, got %q and %q", seen, rec.Header().Get("X-Request-Id"))
+	}
+	if !strings.Contains(logs.String(), `"request_id":"upstream-42"`) {
+		t.Errorf("Expected the context logger to log the request ID, got %s", logs)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/webhook", nil)
+	req.Header.Set("X-Request-Id", "forged\nline")
+	rec = serve(RequestIDHandler(), handler, req)
+	if len(seen) != 32 || seen != rec.Header().Get("X-Request-Id") {
+		t.Errorf("Expected an invalid ID to be replaced by a generated one, got %q", seen)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	mw := CORS(CORSPolicy{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{http.MethodGet, http.MethodPut},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"X-Request-Id"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	reached := false
+	handler := func(http.ResponseWriter, *http.Request) { reached = true }
+
+	req := httptest.NewRequest(http.MethodOptions, "/tasks", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	rec := serve(mw, handler, req)
+	if reached || rec.Code != http.StatusNoContent {
+		t.Errorf("Expected the preflight to be answered by the middleware, got %d", rec.Code)
+	}
+	expected := map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, PUT",
+		"Access-Control-Allow-Headers":     "Authorization, Content-Type",
+		"Access-Control-Max-Age":           "600",
+	}
+	for header, value := range expected {
+		if got := rec.Header().Get(header); got != value {
+			t.Errorf("Expected %s %q, got %q", header, value, got)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/tasks", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec = serve(mw, handler, req)
+	if !reached || rec.Header().Get("Access-Control-Expose-Headers") != "X-Request-Id" {
+		t.Errorf("Expected the request to reach the handler with exposed headers, got %v", rec.Header())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/tasks", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	rec = serve(mw, handler, req)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected no CORS headers for a foreign origin, got %v", rec.Header())
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	ok := func(http.ResponseWriter, *http.Request) {}
+	tests := []struct {
+		name      string
+		mw        ServerMiddleware
+		set       func(r *http.Request)
+		status    int
+		challenge string
+	}{
+		{"bearer", RequireBearerToken("old", "new"), func(r *http.Request) { r.Header.Set("Authorization", "Bearer new") }, http.StatusOK, ""},
+		{"bearer wrong", RequireBearerToken("new"), func(r *http.Request) { r.Header.Set("Authorization", "Bearer old") }, http.StatusUnauthorized, "Bearer"},
+		{"bearer missing", RequireBearerToken("new"), func(*http.Request) {}, http.StatusUnauthorized, "Bearer"},
+		{"basic", RequireBasicAuth("gocore", map[string]string{"vikunja": "s3cret"}), func(r *http.Request) { r.SetBasicAuth("vikunja", "s3cret") }, http.StatusOK, ""},
+		{"basic wrong", RequireBasicAuth("gocore", map[string]string{"vikunja": "s3cret"}), func(r *http.Request) { r.SetBasicAuth("vikunja", "guess") }, http.StatusUnauthorized, `Basic realm="gocore"`},
+		{"basic unknown user", RequireBasicAuth("gocore", map[string]string{"vikunja": ""}), func(r *http.Request) { r.SetBasicAuth("nobody", "") }, http.StatusUnauthorized, `Basic realm="gocore"`},
+		{"shared secret", RequireSharedSecret("X-Webhook-Secret", "hush"), func(r *http.Request) { r.Header.Set("X-Webhook-Secret", "hush") }, http.StatusOK, ""},
+		{"shared secret wrong", RequireSharedSecret("X-Webhook-Secret", "hush"), func(r *http.Request) { r.Header.Set("X-Webhook-Secret", "loud") }, http.StatusUnauthorized, ""},
+		{"shared secret unset", RequireSharedSecret("X-Webhook-Secret", ""), func(*http.Request) {}, http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+			tt.set(req)
+			rec := serve(tt.mw, ok, req)
+			if rec.Code != tt.status || rec.Header().Get("WWW-Authenticate") != tt.challenge {
+				t.Errorf("Expected %d with challenge %q, got %d with %q", tt.status, tt.challenge, rec.Code, rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	var readErr error
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = io.ReadAll(r.Body)
+	}
+
+	rec := serve(MaxBodySize(8), handler, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("0123456789")))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a too large Content-Length, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", io.MultiReader(strings.NewReader("0123456789")))
+	req.ContentLength = -1
+	serve(MaxBodySize(8), handler, req)
+	maxBytesErr := &http.MaxBytesError{}
+	if !errors.As(readErr, &maxBytesErr) || maxBytesErr.Limit != 8 {
+		t.Errorf("Expected a MaxBytesError reading a chunked body, got %v", readErr)
+	}
+
+	serve(MaxBodySize(8), handler, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("01234567")))
+	if readErr != nil {
+		t.Errorf("Expected a body of exactly the limit to be read, got %v", readErr)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	cancelled := make(chan struct{})
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(cancelled)
+	}
+	rec := serve(Timeout(10*time.Millisecond), slow, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Body.String() != "request timed out" {
+		t.Errorf("Expected 503 after the timeout, got %d %q", rec.Code, rec.Body.String())
+	}
+	<-cancelled
+
+	fast := func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("done")) }
+	if rec := serve(Timeout(time.Second), fast, httptest.NewRequest(http.MethodGet, "/", nil)); rec.Body.String() != "done" {
+		t.Errorf("Expected a fast handler to respond, got %q", rec.Body.String())
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	if _, err := RealIP("not-an-ip"); err == nil {
+		t.Errorf("Expected an error for an invalid trusted proxy")
+	}
+	mw, err := RealIP("10.0.0.0/8", "192.168.1.1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		expected   string
+	}{
+		{"direct client", "203.0.113.7:5123", nil, "", "203.0.113.7"},
+		{"untrusted peer is not believed", "203.0.113.7:5123", []string{"198.51.100.1"}, "", "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:443", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"proxy chain", "10.1.2.3:443", []string{"6.6.6.6, 198.51.100.1", "192.168.1.1"}, "", "198.51.100.1"},
+		{"all hops trusted", "10.1.2.3:443", []string{"10.9.9.9, 10.8.8.8"}, "", "10.9.9.9"},
+		{"malformed hop", "10.1.2.3:443", []string{"198.51.100.1, garbage"}, "", "10.1.2.3"},
+		{"x-real-ip", "192.168.1.1:80", nil, "198.51.100.9", "198.51.100.9"},
+		{"ipv4 mapped peer", "[::ffff:10.1.2.3]:443", []string{"2001:db8::1"}, "", "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			var got, remoteAddr string
+			serve(mw, func(w http.ResponseWriter, r *http.Request) {
+				got, remoteAddr = ClientIPFromContext(r.Context()), r.RemoteAddr
+			}, req)
+			if got != tt.expected || remoteAddr != tt.expected {
+				t.Errorf("Expected client IP %s, got %s with RemoteAddr %s", tt.expected, got, remoteAddr)
+			}
+		})
+	}
+}
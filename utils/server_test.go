@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startServer starts a Server on a free port and returns its base URL.
+func startServer(t *testing.T, s *Server) string {
+	t.Helper()
+	if err := s.Start(); err != nil {
+		t.Fatalf("Error starting server: %v", err)
+	}
+	return "http://" + s.ListenAddr().String()
+}
+
+func TestServerDrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	s := NewServer("127.0.0.1:0", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		_, _ = w.Write([]byte("done"))
+	}))
+	hookRan := false
+	s.OnShutdown(func(context.Context) error {
+		hookRan = true
+		return nil
+	})
+	url := startServer(t, s)
+
+	result := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			result <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		result <- string(body)
+	}()
+
+	<-started
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Unexpected shutdown error: %v", err)
+	}
+	if got := <-result; got != "done" {
+		t.Errorf("Expected the in-flight request to complete, got %q", got)
+	}
+	if !hookRan {
+		t.Errorf("Expected the shutdown hook to run")
+	}
+	if _, err := http.Get(url); err == nil {
+		t.Errorf("Expected new connections to be refused after shutdown")
+	}
+	if err := s.Start(); !errors.Is(err, ErrServerStarted) {
+		t.Errorf("Expected ErrServerStarted when restarting, got %v", err)
+	}
+}
+
+func TestServerGracePeriodCancelsRequests(t *testing.T) {
+	cancelled := make(chan struct{})
+	started := make(chan struct{})
+	s := NewServer("127.0.0.1:0", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+		close(cancelled)
+	}))
+	failing := errors.New("flush failed")
+	var hookErr error
+	s.OnShutdown(func(ctx context.Context) error {
+		hookErr = ctx.Err()
+		return failing
+	})
+	url := startServer(t, s)
+
+	go func() {
+		if resp, err := http.Get(url); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := s.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, failing) {
+		t.Errorf("Expected the drain and hook errors, got %v", err)
+	}
+	if hookErr != nil {
+		t.Errorf("Expected the hook to get time of its own after the grace period ran out, got %v", hookErr)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Errorf("Expected the request context to be cancelled once the grace period ran out")
+	}
+}
+
+func TestServerRun(t *testing.T) {
+	taken := NewServer("127.0.0.1:0", http.NotFoundHandler())
+	startServer(t, taken)
+	defer taken.Shutdown(context.Background())
+
+	if err := NewServer(taken.ListenAddr().String(), http.NotFoundHandler()).Run(context.Background()); err == nil {
+		t.Errorf("Expected Run to return the listen error for a taken port")
+	}
+
+	logs := &bytes.Buffer{}
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(logs, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	for _, stop := range []string{"context", "signal", "shutdown"} {
+		ctx, cancel := context.WithCancel(context.Background())
+		s := NewServer("127.0.0.1:0", http.NotFoundHandler())
+		s.GracePeriod = time.Second
+		hookRan := make(chan struct{})
+		s.OnShutdown(func(context.Context) error {
+			time.Sleep(20 * time.Millisecond)
+			// Closing twice panics, so this also checks the hook runs once.
+			close(hookRan)
+			return nil
+		})
+
+		done := make(chan error, 1)
+		go func() { done <- s.Run(ctx) }()
+		for s.ListenAddr() == nil {
+			time.Sleep(time.Millisecond)
+		}
+
+		switch stop {
+		case "context":
+			cancel()
+		case "signal":
+			if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+				t.Fatalf("Error sending SIGTERM: %v", err)
+			}
+		case "shutdown":
+			// Called elsewhere, Run then waits for this call to finish instead of shutting down again.
+			go func() {
+				if err := s.Shutdown(context.Background()); err != nil {
+					t.Errorf("Unexpected error shutting down: %v", err)
+				}
+			}()
+		}
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Expected a clean shutdown on %s, got %v", stop, err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected Run to return on %s", stop)
+		}
+		select {
+		case <-hookRan:
+		default:
+			t.Errorf("Expected Run to return once the shutdown hook finished on %s", stop)
+		}
+		cancel()
+	}
+
+	if strings.Contains(logs.String(), "API server failed") {
+		t.Errorf("Expected no failure to be logged for a clean shutdown, got %s", logs)
+	}
+}
@@ -0,0 +1,366 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a single server-sent event read from a text/event-stream response.
+type Event struct {
+	// ID is the last event ID the server sent, it is carried over from earlier events that set it.
+	ID string
+	// Event is the event type, "message" when the server did not send one.
+	Event string
+	// Data is the event payload, multiple data lines are joined with "\n".
+	Data string
+}
+
+// StreamOptions describes the request opening a stream and how a dropped event stream is resumed.
+type StreamOptions struct {
+	// Method is the request method, GET when empty.
+	Method string
+	// Request is sent as the request body like the request of MakeAPIRequest, it is encoded again for every reconnect.
+	Request interface{}
+	// LastEventID is sent as Last-Event-ID on the first connection, to resume a stream read earlier.
+	LastEventID string
+	// MaxReconnects is how many times in a row a dropped event stream is reopened without receiving an event,
+	// 0 disables reconnecting and a negative value reconnects until ctx is done. NDJSON streams are never reopened.
+	MaxReconnects int
+	// ReconnectDelay is the wait before reopening a dropped event stream, 1 second when 0.
+	// A retry field sent by the server takes precedence.
+	ReconnectDelay time.Duration
+}
+
+// maxStreamLine is the longest line a stream may contain when the client sets no MaxResponseSize.
+const maxStreamLine = 1 << 20
+
+// StreamEvents opens a text/event-stream endpoint and yields its events as they arrive.
+// A stream dropped by the server or the network is reopened according to opts, sending the last event ID
+// in Last-Event-ID so the server can resume it. The client's MaxResponseSize caps each line, not the whole stream.
+// Cancelling ctx ends the iteration with ctx's error, breaking out of the loop closes the connection.
+func StreamEvents(ctx context.Context, c *AuthenticatedAPIClient, endpoint string, opts StreamOptions) iter.Seq2[Event, error] {
+	return c.streamEvents(ctx, slog.Default().With("endpoint", endpoint), endpoint, opts, nil)
+}
+
+// streamEvents is StreamEvents reading resp first when it is not nil, a stream Stream already opened.
+func (c *AuthenticatedAPIClient) streamEvents(ctx context.Context, l *slog.Logger, endpoint string, opts StreamOptions, resp *http.Response) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		lastEventID := opts.LastEventID
+		delay := opts.ReconnectDelay
+		if delay <= 0 {
+			delay = time.Second
+		}
+
+		for reconnects := 0; ; {
+			var err error
+			if resp == nil {
+				resp, err = c.openStream(ctx, l, endpoint, opts, lastEventID)
+				// Failing to reopen the stream, e.g. while the server restarts, counts as another drop.
+				var apiErr *APIError
+				if err != nil && (reconnects == 0 || errors.As(err, &apiErr)) {
+					yield(Event{}, err)
+					return
+				}
+			}
+
+			stopped := false
+			if err == nil {
+				// 204 No Content is how a server tells the client to stop reconnecting.
+				if resp.StatusCode == http.StatusNoContent {
+					resp.Body.Close()
+					return
+				}
+
+				reader := newEventReader(resp.Body, c.maxStreamLine(), lastEventID, redactURL(resp.Request.URL))
+				for {
+					event, readErr := reader.next()
+					if readErr == nil && ctx.Err() != nil {
+						// Events already buffered are not delivered once the caller cancelled.
+						readErr = ctx.Err()
+					}
+					if readErr != nil {
+						err = readErr
+						break
+					}
+					reconnects = 0
+					if !yield(event, nil) {
+						stopped = true
+						break
+					}
+				}
+				resp.Body.Close()
+				lastEventID = reader.lastEventID
+				if reader.retry > 0 {
+					delay = reader.retry
+				}
+			}
+			resp = nil
+
+			switch {
+			case stopped:
+				return
+			case ctx.Err() != nil:
+				yield(Event{}, ctx.Err())
+				return
+			case errors.Is(err, ErrResponseTooLarge):
+				yield(Event{}, err)
+				return
+			case opts.MaxReconnects >= 0 && reconnects >= opts.MaxReconnects:
+				if !errors.Is(err, io.EOF) {
+					yield(Event{}, err)
+				}
+				return
+			}
+
+			reconnects++
+			l.Warn("Event stream dropped, reconnecting", "error", err, "lastEventID", lastEventID, "delay", delay, "attempt", reconnects)
+			if err := sleepContext(ctx, delay); err != nil {
+				yield(Event{}, err)
+				return
+			}
+		}
+	}
+}
+
+// Stream opens a streaming endpoint and yields every message decoded as JSON into T.
+// A text/event-stream response is read through StreamEvents, every event's data being one message, and a
+// "[DONE]" message as sent by LLM APIs ends the stream. Any other response is read as newline-delimited JSON.
+func Stream[T any](ctx context.Context, c *AuthenticatedAPIClient, endpoint string, opts StreamOptions) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		l := slog.Default().With("endpoint", endpoint)
+		decode := c.JSON.decoder()
+
+		resp, err := c.openStream(ctx, l, endpoint, opts, opts.LastEventID)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		if resp.StatusCode == http.StatusNoContent {
+			resp.Body.Close()
+			return
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if mediaType == "text/event-stream" {
+			for event, err := range c.streamEvents(ctx, l, endpoint, opts, resp) {
+				if err != nil {
+					yield(zero, err)
+					return
+				}
+				if event.Data == "[DONE]" {
+					return
+				}
+				var msg T
+				if err := decode([]byte(event.Data), &msg); err != nil {
+					yield(zero, err)
+					return
+				}
+				if !yield(msg, nil) {
+					return
+				}
+			}
+			return
+		}
+
+		defer resp.Body.Close()
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(nil, c.maxStreamLine())
+		for scanner.Scan() && ctx.Err() == nil {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			var msg T
+			if err := decode(line, &msg); err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(msg, nil) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil || ctx.Err() != nil {
+			switch {
+			case ctx.Err() != nil:
+				err = ctx.Err()
+			case errors.Is(err, bufio.ErrTooLong):
+				err = &ResponseTooLargeError{Limit: int64(c.maxStreamLine()), URL: redactURL(resp.Request.URL)}
+			}
+			yield(zero, err)
+		}
+	}
+}
+
+// openStream sends the request opening a stream and returns the response once its headers arrived.
+// The request is not retried and holds no in-flight slot of the Limiter, a stream may stay open indefinitely.
+func (c *AuthenticatedAPIClient) openStream(ctx context.Context, l *slog.Logger, endpoint string, opts StreamOptions, lastEventID string) (*http.Response, error) {
+	method := opts.Method
+	if method == "" {
+		method = MethodGet
+	}
+
+	req, err := c.newRequest(ctx, l, method, endpoint, opts.Request)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream, application/x-ndjson")
+	req.Header.Set("Cache-Control", "no-cache")
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	done, err := c.Breaker.allow(ctx)
+	if err == nil {
+		if err = c.Limiter.wait(ctx); err != nil {
+			done(nil, err)
+		}
+	}
+	if err != nil {
+		// Streamed bodies such as MultipartBody produce from a goroutine until closed.
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	done(resp, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		body, err := readErrorBody(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return nil, newAPIError(resp, body)
+	}
+
+	return resp, nil
+}
+
+// maxStreamLine returns the longest line a stream read by the client may contain.
+func (c *AuthenticatedAPIClient) maxStreamLine() int {
+	if c.MaxResponseSize > 0 && c.MaxResponseSize < maxStreamLine {
+		return int(c.MaxResponseSize)
+	}
+	return maxStreamLine
+}
+
+// eventReader parses a text/event-stream body as described by the HTML living standard.
+type eventReader struct {
+	scanner *bufio.Scanner
+	// tooLarge is returned when a line exceeds the limit.
+	tooLarge *ResponseTooLargeError
+	// lastEventID and retry are the last id and retry fields seen, they persist across events.
+	lastEventID string
+	retry       time.Duration
+}
+
+// newEventReader reads events of the stream at url from r, lines longer than limit fail with ErrResponseTooLarge.
+func newEventReader(r io.Reader, limit int, lastEventID, url string) *eventReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, limit)
+	scanner.Split(scanEventLines)
+	return &eventReader{
+		scanner:     scanner,
+		tooLarge:    &ResponseTooLargeError{Limit: int64(limit), URL: url},
+		lastEventID: lastEventID,
+	}
+}
+
+// next returns the next event, io.EOF once the stream ended cleanly.
+func (r *eventReader) next() (Event, error) {
+	var data strings.Builder
+	hasData := false
+	eventType := ""
+
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		if line == "" {
+			if !hasData {
+				eventType = ""
+				continue
+			}
+			if eventType == "" {
+				eventType = "message"
+			}
+			return Event{ID: r.lastEventID, Event: eventType, Data: data.String()}, nil
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				r.lastEventID = value
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				r.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+
+	err := r.scanner.Err()
+	if errors.Is(err, bufio.ErrTooLong) {
+		return Event{}, r.tooLarge
+	}
+	if err == nil {
+		// An event not terminated by a blank line is discarded, as the stream ended in the middle of it.
+		err = io.EOF
+	}
+	return Event{}, err
+}
+
+// scanEventLines is bufio.ScanLines also accepting a lone "\r" as the line terminator, as event streams may use it.
+func scanEventLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		// A "\r" at the end of the buffer may be the first half of "\r\n".
+		if i+1 == len(data) && !atEOF {
+			return 0, nil, nil
+		}
+		if i+1 < len(data) && data[i+1] == '\n' {
+			return i + 2, data[:i], nil
+		}
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sseServer streams numbered events, dropping the connection after every two events, and resumes from Last-Event-ID.
+func sseServer(t *testing.T, total int) (*httptest.Server, *[]string) {
+	var mu sync.Mutex
+	var lastEventIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		mu.Unlock()
+
+		next := 1
+		if id := r.Header.Get("Last-Event-ID"); id != "" {
+			n, err := strconv.Atoi(id)
+			if err != nil {
+				t.Errorf("Unexpected Last-Event-ID %q", id)
+			}
+			next = n + 1
+		}
+		if next > total {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, ": keep-alive\nretry: 1\n\n")
+		for i := next; i <= total && i < next+2; i++ {
+			_, _ = fmt.Fprintf(w, "id: %d\nevent: tick\ndata: {\"n\": %d,\ndata:  \"label\": \"tick\"}\r\n\r\n", i, i)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	return server, &lastEventIDs
+}
+
+func TestStreamEventsReconnects(t *testing.T) {
+	server, lastEventIDs := sseServer(t, 5)
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "")
+	var events []Event
+	for event, err := range StreamEvents(context.Background(), &apiClient, "/events", StreamOptions{MaxReconnects: 3}) {
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		events = append(events, event)
+	}
+
+	if len(events) != 5 {
+		t.Fatalf("Expected 5 events across reconnects, got %d", len(events))
+	}
+	if events[4].ID != "5" || events[4].Event != "tick" || events[4].Data != "{\"n\": 5,\n \"label\": \"tick\"}" {
+		t.Errorf("Unexpected event %+v", events[4])
+	}
+	expected := []string{"", "2", "4", "5"}
+	if fmt.Sprint(*lastEventIDs) != fmt.Sprint(expected) {
+		t.Errorf("Expected Last-Event-ID %q, got %q", expected, *lastEventIDs)
+	}
+}
+
+func TestStreamDecodesEventsAndNDJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/completions" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = fmt.Fprint(w, "data: {\"n\": 1}\n\ndata: {\"n\": 2}\n\ndata: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		_, _ = fmt.Fprint(w, "{\"n\": 1}\n\n{\"n\": 2}\n{\"n\": 3}\n")
+	}))
+	defer server.Close()
+
+	type chunk struct {
+		N int `json:"n"`
+	}
+	apiClient := NewAPIClient(server.URL, "")
+	ctx := context.Background()
+
+	for path, expected := range map[string]int{"/completions": 2, "/logs": 3} {
+		var got []int
+		for msg, err := range Stream[chunk](ctx, &apiClient, path, StreamOptions{Method: MethodPost, Request: map[string]bool{"stream": true}}) {
+			if err != nil {
+				t.Fatalf("Unexpected error from %s: %v", path, err)
+			}
+			got = append(got, msg.N)
+		}
+		if len(got) != expected || got[len(got)-1] != expected {
+			t.Errorf("Expected %d messages from %s, got %v", expected, path, got)
+		}
+	}
+}
+
+func TestStreamCancellation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; ; i++ {
+			if _, err := fmt.Fprintf(w, "data: %d\n\n", i); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := 0
+	var streamErr error
+	for _, err := range StreamEvents(ctx, &apiClient, "/events", StreamOptions{MaxReconnects: -1}) {
+		if err != nil {
+			streamErr = err
+			break
+		}
+		received++
+		if received == 3 {
+			cancel()
+		}
+	}
+	if !errors.Is(streamErr, context.Canceled) || received != 3 {
+		t.Errorf("Expected the stream to end with context.Canceled after 3 events, got %d events and %v", received, streamErr)
+	}
+
+	apiClient = NewAPIClient(server.URL, "", WithMaxResponseSize(8))
+	for _, err := range StreamEvents(context.Background(), &apiClient, "/events", StreamOptions{}) {
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, ErrResponseTooLarge) {
+			t.Errorf("Expected ErrResponseTooLarge for an overlong line, got %v", err)
+		}
+		break
+	}
+}
+
+func TestStreamClosesBodyWhenBreakerIsOpen(t *testing.T) {
+	breaker := NewCircuitBreaker("test")
+	breaker.MinRequests = 1
+	done, _ := breaker.allow(context.Background())
+	done(nil, errors.New("connection refused"))
+
+	before := runtime.NumGoroutine()
+	apiClient := NewAPIClient("http://127.0.0.1:1", "", WithBreaker(breaker))
+	opts := StreamOptions{Method: MethodPost, Request: MultipartBody{Fields: url.Values{"prompt": {"hello"}}}}
+	for _, err := range Stream[map[string]string](context.Background(), &apiClient, "/chat", opts) {
+		if !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("Expected ErrCircuitOpen, got %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if runtime.NumGoroutine() > before {
+		t.Errorf("Expected the multipart writer to stop, %d goroutines left over", runtime.NumGoroutine()-before)
+	}
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// telemetryScope is the instrumentation scope name of the spans and metrics produced by TelemetryMiddleware.
+const telemetryScope = "github.com/atropos112/gocore/utils"
+
+// TelemetryConfig selects where TelemetryMiddleware sends spans and metrics, nil fields fall back to the otel globals.
+type TelemetryConfig struct {
+	TracerProvider trace.TracerProvider
+	MeterProvider  metric.MeterProvider
+	// Propagator injects the trace context into outgoing requests, W3C traceparent and baggage when nil.
+	Propagator propagation.TextMapPropagator
+}
+
+// TelemetryMiddleware creates a client span for every request with the HTTP semantic convention attributes,
+// propagates the trace context to the server and records request duration, size and status histograms.
+func TelemetryMiddleware(cfg TelemetryConfig) Middleware {
+	tracerProvider := cfg.TracerProvider
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
+	meterProvider := cfg.MeterProvider
+	if meterProvider == nil {
+		meterProvider = otel.GetMeterProvider()
+	}
+	propagator := cfg.Propagator
+	if propagator == nil {
+		propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	}
+
+	tracer := tracerProvider.Tracer(telemetryScope)
+	meter := meterProvider.Meter(telemetryScope)
+
+	// Instrument creation only fails on invalid names, which these are not, the no-op instruments returned alongside are used then.
+	duration, _ := meter.Float64Histogram("http.client.request.duration",
+		metric.WithUnit("s"), metric.WithDescription("Duration of HTTP client requests."))
+	requestSize, _ := meter.Int64Histogram("http.client.request.body.size",
+		metric.WithUnit("By"), metric.WithDescription("Size of HTTP client request bodies."))
+	responseSize, _ := meter.Int64Histogram("http.client.response.body.size",
+		metric.WithUnit("By"), metric.WithDescription("Size of HTTP client response bodies."))
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+
+			attrs := []attribute.KeyValue{
+				attribute.String("http.request.method", req.Method),
+				attribute.String("server.address", req.URL.Hostname()),
+			}
+			if port, err := strconv.Atoi(req.URL.Port()); err == nil {
+				attrs = append(attrs, attribute.Int("server.port", port))
+			}
+
+			ctx, span := tracer.Start(req.Context(), req.Method,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(attrs...),
+				trace.WithAttributes(attribute.String("url.full", redactURL(req.URL))),
+			)
+			defer span.End()
+
+			req = req.Clone(ctx)
+			propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+			resp, err := next.RoundTrip(req)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				attrs = append(attrs, attribute.String("error.type", "network"))
+			} else {
+				attrs = append(attrs, attribute.Int("http.response.status_code", resp.StatusCode))
+				span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+				if resp.StatusCode >= 400 {
+					attrs = append(attrs, attribute.String("error.type", strconv.Itoa(resp.StatusCode)))
+					span.SetAttributes(attribute.String("error.type", strconv.Itoa(resp.StatusCode)))
+					span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+				}
+			}
+
+			measurement := metric.WithAttributes(attrs...)
+			duration.Record(ctx, time.Since(start).Seconds(), measurement)
+			if req.ContentLength > 0 {
+				requestSize.Record(ctx, req.ContentLength, measurement)
+			}
+			if resp != nil && resp.ContentLength >= 0 {
+				responseSize.Record(ctx, resp.ContentLength, measurement)
+			}
+
+			return resp, err
+		})
+	}
+}
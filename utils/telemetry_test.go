@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTelemetryMiddleware(t *testing.T) {
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	reader := sdkmetric.NewManualReader()
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	apiClient := NewAPIClient(server.URL, "", WithTelemetry(TelemetryConfig{TracerProvider: tracerProvider, MeterProvider: meterProvider}))
+	ctx := context.Background()
+
+	if _, err := Get[map[string]interface{}](ctx, &apiClient, "/items?token=secret"); err != nil {
+		t.Fatalf("Error making GET request: %v", err)
+	}
+	_, _ = Get[map[string]interface{}](ctx, &apiClient, "/missing")
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+
+	ok := spans[0]
+	if ok.Name != http.MethodGet || ok.Status.Code == codes.Error {
+		t.Errorf("Unexpected span %s with status %v", ok.Name, ok.Status)
+	}
+	attrs := attribute.NewSet(ok.Attributes...)
+	if v, _ := attrs.Value("http.response.status_code"); v.AsInt64() != http.StatusOK {
+		t.Errorf("Expected status code attribute 200, got %v", v)
+	}
+	if v, _ := attrs.Value("url.full"); v.AsString() == "" || v.AsString() == server.URL+"/items?token=secret" {
+		t.Errorf("Expected a redacted url.full attribute, got %q", v.AsString())
+	}
+	if traceparent == "" || spans[1].SpanContext.TraceID().String() != traceparent[3:35] {
+		t.Errorf("Expected traceparent of the client span to be propagated, got %q", traceparent)
+	}
+	if spans[1].Status.Code != codes.Error {
+		t.Errorf("Expected 404 span to have error status, got %v", spans[1].Status)
+	}
+
+	metrics := metricdata.ResourceMetrics{}
+	if err := reader.Collect(ctx, &metrics); err != nil {
+		t.Fatalf("Error collecting metrics: %v", err)
+	}
+	found := false
+	for _, scope := range metrics.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name != "http.client.request.duration" {
+				continue
+			}
+			found = true
+			histogram := m.Data.(metricdata.Histogram[float64])
+			var count uint64
+			for _, point := range histogram.DataPoints {
+				count += point.Count
+			}
+			if count != 2 {
+				t.Errorf("Expected 2 recorded durations, got %d", count)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected http.client.request.duration to be recorded")
+	}
+}
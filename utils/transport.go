@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// TransportOptions describes the TLS, proxy and timeout settings of the http.Client built by NewHTTPClient.
+type TransportOptions struct {
+	// CAFile is a PEM bundle of extra certificate authorities trusted on top of the system pool, e.g. a private CA.
+	CAFile string
+	// CertFile and KeyFile are the PEM client certificate and key presented for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify disables server certificate verification, for development only.
+	InsecureSkipVerify bool
+	// ProxyURL is the proxy every request goes through, "" means the HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables.
+	ProxyURL string
+	// ConnectTimeout limits establishing the TCP connection, 30 seconds when 0.
+	ConnectTimeout time.Duration
+	// TLSHandshakeTimeout limits the TLS handshake, 10 seconds when 0.
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout limits waiting for the response headers once the request is sent, 0 means no limit.
+	ResponseHeaderTimeout time.Duration
+	// Timeout limits the whole request including reading the body, 0 means no limit.
+	Timeout time.Duration
+}
+
+// TransportOptionsFromEnv reads TransportOptions from environment variables named prefix followed by
+// _CA_FILE, _CLIENT_CERT_FILE, _CLIENT_KEY_FILE, _INSECURE_SKIP_VERIFY, _PROXY_URL, _CONNECT_TIMEOUT,
+// _TLS_HANDSHAKE_TIMEOUT, _RESPONSE_HEADER_TIMEOUT and _TIMEOUT, e.g. GOCORE_VIKUNJA_CA_FILE.
+// Every variable is optional, durations use time.ParseDuration syntax such as "10s".
+func TransportOptionsFromEnv(prefix string) (TransportOptions, error) {
+	o := TransportOptions{
+		CAFile:   optionalCred(prefix + "_CA_FILE"),
+		CertFile: optionalCred(prefix + "_CLIENT_CERT_FILE"),
+		KeyFile:  optionalCred(prefix + "_CLIENT_KEY_FILE"),
+		ProxyURL: optionalCred(prefix + "_PROXY_URL"),
+	}
+
+	if value := optionalCred(prefix + "_INSECURE_SKIP_VERIFY"); value != "" {
+		insecure, err := strconv.ParseBool(value)
+		if err != nil {
+			return TransportOptions{}, fmt.Errorf("%s_INSECURE_SKIP_VERIFY: %w", prefix, err)
+		}
+		o.InsecureSkipVerify = insecure
+	}
+
+	durations := map[string]*time.Duration{
+		"_CONNECT_TIMEOUT":         &o.ConnectTimeout,
+		"_TLS_HANDSHAKE_TIMEOUT":   &o.TLSHandshakeTimeout,
+		"_RESPONSE_HEADER_TIMEOUT": &o.ResponseHeaderTimeout,
+		"_TIMEOUT":                 &o.Timeout,
+	}
+	for suffix, target := range durations {
+		value := optionalCred(prefix + suffix)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return TransportOptions{}, fmt.Errorf("%s%s: %w", prefix, suffix, err)
+		}
+		*target = d
+	}
+
+	return o, nil
+}
+
+// optionalCred returns the credential called name, "" if it is not set.
+func optionalCred(name string) string {
+	cred, _ := GetCred(name)
+	return cred
+}
+
+// NewHTTPClient builds an http.Client with a transport configured according to the options.
+func (o TransportOptions) NewHTTPClient() (*http.Client, error) {
+	tlsConfig, err := o.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if o.ProxyURL != "" {
+		proxyURL, err := url.Parse(o.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	connectTimeout := o.ConnectTimeout
+	if connectTimeout == 0 {
+		connectTimeout = 30 * time.Second
+	}
+	handshakeTimeout := o.TLSHandshakeTimeout
+	if handshakeTimeout == 0 {
+		handshakeTimeout = 10 * time.Second
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = handshakeTimeout
+	transport.ResponseHeaderTimeout = o.ResponseHeaderTimeout
+	transport.TLSClientConfig = tlsConfig
+	transport.Proxy = proxy
+
+	return &http.Client{Transport: transport, Timeout: o.Timeout}, nil
+}
+
+// tlsConfig builds the TLS configuration for the CA bundle, client certificate and verification settings.
+func (o TransportOptions) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// Skipping verification is an explicit opt-in for development setups.
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", o.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		if o.CertFile == "" || o.KeyFile == "" {
+			return nil, errors.New("client certificate and key must be provided together")
+		}
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writePEM writes a PEM block of the given type to a file in dir and returns its path.
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Error writing %s: %v", name, err)
+	}
+	return path
+}
+
+// clientCertificate generates a self-signed client certificate and key, returning their PEM file paths.
+func clientCertificate(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gocore-test-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Error creating certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Error marshalling key: %v", err)
+	}
+	return writePEM(t, dir, "client.crt", "CERTIFICATE", der), writePEM(t, dir, "client.key", "EC PRIVATE KEY", keyDER)
+}
+
+func TestTransportOptionsTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"client": "` + r.TLS.PeerCertificates[0].Subject.CommonName + `"}`))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := writePEM(t, dir, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	certFile, keyFile := clientCertificate(t, dir)
+	ctx := context.Background()
+
+	// Without the private CA the server certificate is rejected.
+	httpClient, err := TransportOptions{}.NewHTTPClient()
+	if err != nil {
+		t.Fatalf("Error building client: %v", err)
+	}
+	apiClient := NewAPIClient(server.URL, "", WithHTTPClient(httpClient))
+	if _, err := Get[map[string]string](ctx, &apiClient, "/"); err == nil {
+		t.Errorf("Expected certificate verification to fail without the CA")
+	}
+
+	httpClient, err = TransportOptions{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, Timeout: 5 * time.Second}.NewHTTPClient()
+	if err != nil {
+		t.Fatalf("Error building client: %v", err)
+	}
+	apiClient = NewAPIClient(server.URL, "", WithHTTPClient(httpClient))
+	got, err := Get[map[string]string](ctx, &apiClient, "/")
+	if err != nil || got["client"] != "gocore-test-client" {
+		t.Errorf("Expected mutual TLS to succeed, got %v, %v", got, err)
+	}
+
+	httpClient, _ = TransportOptions{InsecureSkipVerify: true}.NewHTTPClient()
+	apiClient = NewAPIClient(server.URL, "", WithHTTPClient(httpClient))
+	if _, err := Get[map[string]string](ctx, &apiClient, "/"); !IsUnauthorized(err) {
+		t.Errorf("Expected InsecureSkipVerify to connect without a client certificate, got %v", err)
+	}
+}
+
+func TestTransportOptionsFromEnv(t *testing.T) {
+	t.Setenv("GOCORE_TEST_CA_FILE", "/etc/ssl/private-ca.pem")
+	t.Setenv("GOCORE_TEST_INSECURE_SKIP_VERIFY", "true")
+	t.Setenv("GOCORE_TEST_PROXY_URL", "http://proxy.lan:3128")
+	t.Setenv("GOCORE_TEST_TIMEOUT", "15s")
+	t.Setenv("GOCORE_TEST_CONNECT_TIMEOUT", "2s")
+
+	o, err := TransportOptionsFromEnv("GOCORE_TEST")
+	if err != nil {
+		t.Fatalf("Error reading options: %v", err)
+	}
+	expected := TransportOptions{
+		CAFile:             "/etc/ssl/private-ca.pem",
+		InsecureSkipVerify: true,
+		ProxyURL:           "http://proxy.lan:3128",
+		Timeout:            15 * time.Second,
+		ConnectTimeout:     2 * time.Second,
+	}
+	if o != expected {
+		t.Errorf("Expected %+v, got %+v", expected, o)
+	}
+
+	t.Setenv("GOCORE_TEST_TIMEOUT", "soon")
+	if _, err := TransportOptionsFromEnv("GOCORE_TEST"); err == nil {
+		t.Errorf("Expected an error for an invalid duration")
+	}
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+)
+
+// Get makes a GET request to the specified endpoint and returns the decoded response.
+func Get[Resp any](ctx context.Context, c *AuthenticatedAPIClient, endpoint string) (Resp, error) {
+	return Do[Resp](ctx, c, http.MethodGet, endpoint, nil)
+}
+
+// Delete makes a DELETE request to the specified endpoint and returns the decoded response.
+func Delete[Resp any](ctx context.Context, c *AuthenticatedAPIClient, endpoint string) (Resp, error) {
+	return Do[Resp](ctx, c, http.MethodDelete, endpoint, nil)
+}
+
+// Post makes a POST request with request as its JSON body to the specified endpoint and returns the decoded response.
+func Post[Resp, Req any](ctx context.Context, c *AuthenticatedAPIClient, endpoint string, request Req) (Resp, error) {
+	return Do[Resp](ctx, c, http.MethodPost, endpoint, request)
+}
+
+// Put makes a PUT request with request as its JSON body to the specified endpoint and returns the decoded response.
+func Put[Resp, Req any](ctx context.Context, c *AuthenticatedAPIClient, endpoint string, request Req) (Resp, error) {
+	return Do[Resp](ctx, c, http.MethodPut, endpoint, request)
+}
+
+// Patch makes a PATCH request with request as its JSON body to the specified endpoint and returns the decoded response.
+func Patch[Resp, Req any](ctx context.Context, c *AuthenticatedAPIClient, endpoint string, request Req) (Resp, error) {
+	return Do[Resp](ctx, c, http.MethodPatch, endpoint, request)
+}
+
+// Do makes a request of the given method to the specified endpoint and returns the decoded response.
+// On error the zero value of Resp is returned, never a partially decoded one.
+func Do[Resp any](ctx context.Context, c *AuthenticatedAPIClient, method, endpoint string, request any) (Resp, error) {
+	var response Resp
+	if err := c.makeRequest(ctx, method, endpoint, request, &response); err != nil {
+		var zero Resp
+		return zero, err
+	}
+
+	return response, nil
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type echoPayload struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestTypedGetAndPost(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(`{"name": "get", "count": 1}`))
+			return
+		}
+		// Echo the request body back so the round trip of the typed request can be checked.
+		payload := echoPayload{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		payload.Count++
+		_ = json.NewEncoder(w).Encode(payload)
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "")
+	ctx := context.Background()
+
+	got, err := Get[echoPayload](ctx, &apiClient, "/item")
+	if err != nil {
+		t.Fatalf("Error making typed GET request: %v", err)
+	}
+	if got != (echoPayload{Name: "get", Count: 1}) {
+		t.Errorf("Unexpected GET response %+v", got)
+	}
+
+	posted, err := Post[echoPayload](ctx, &apiClient, "/item", echoPayload{Name: "post", Count: 41})
+	if err != nil {
+		t.Fatalf("Error making typed POST request: %v", err)
+	}
+	if posted != (echoPayload{Name: "post", Count: 42}) {
+		t.Errorf("Unexpected POST response %+v", posted)
+	}
+}
+
+func TestTypedReturnsZeroValueOnError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"name": "partial"}`))
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(server.URL, "")
+
+	got, err := Get[echoPayload](context.Background(), &apiClient, "/missing")
+	if err == nil {
+		t.Fatalf("Expected error for 404 response")
+	}
+	if got != (echoPayload{}) {
+		t.Errorf("Expected zero value on error, got %+v", got)
+	}
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 )
@@ -8,37 +9,110 @@ import (
 // AuthenticatedAPIClient is a struct that contains the base URL of the API and the token to use for requests.
 type AuthenticatedAPIClient struct {
 	BaseURL string
-	Token   string
-	Client  *http.Client
+	// Token is sent as a Bearer token when Auth is nil, it is ignored otherwise.
+	Token  string
+	Client *http.Client
+	// Auth adds credentials to every request, it takes precedence over Token.
+	Auth Authenticator
+	// Decoders overrides how response bodies are decoded per media type, e.g. "application/yaml".
+	// JSON and XML are decoded by default, a *[]byte, *string or io.Writer response receives the body undecoded.
+	Decoders map[string]ResponseDecoder
+	// BodyPolicy decides which methods may carry a request body, nil means DefaultBodyPolicy.
+	BodyPolicy BodyPolicy
+	// Retry is the policy used to retry failed requests, nil means every request is attempted exactly once.
+	Retry *RetryPolicy
+	// Cache serves GET requests from previously received responses, nil disables caching.
+	Cache *ResponseCache
+	// Breaker fails requests fast while the upstream is unhealthy, nil disables it.
+	Breaker *CircuitBreaker
+	// Limiter throttles requests, share one between clients to throttle them together. nil means no throttling.
+	Limiter *RateLimiter
+	// IdempotencyKeys attaches a fresh Idempotency-Key header to every mutating request, kept across its retries.
+	// A key set with ContextWithIdempotencyKey is sent regardless.
+	IdempotencyKeys bool
+	// MaxResponseSize caps the size of response bodies in bytes, a larger one fails with ErrResponseTooLarge.
+	// 0 means no limit.
+	MaxResponseSize int64
+	// JSON selects strict decoding of JSON response bodies.
+	JSON JSONOptions
 }
 
 // NewAPIClient creates a new AuthenticatedAPIClient with the specified base URL and token.
-func NewAPIClient(baseURL, token string) AuthenticatedAPIClient {
-	return AuthenticatedAPIClient{
+func NewAPIClient(baseURL, token string, opts ...ClientOption) AuthenticatedAPIClient {
+	c := AuthenticatedAPIClient{
 		BaseURL: baseURL,
 		Token:   token,
 		Client:  http.DefaultClient,
 	}
+	c.apply(opts)
+	return c
 }
 
-// Delete is a helper function to make a DELETE request to the specified endpoint. If token is not "" it will be added to the request as a Bearer token.
+// NewAPIClientWithAuth creates a new AuthenticatedAPIClient with the specified base URL that authenticates requests using auth.
+func NewAPIClientWithAuth(baseURL string, auth Authenticator, opts ...ClientOption) AuthenticatedAPIClient {
+	c := AuthenticatedAPIClient{
+		BaseURL: baseURL,
+		Auth:    auth,
+		Client:  http.DefaultClient,
+	}
+	c.apply(opts)
+	return c
+}
+
+// URL returns the absolute URL of endpoint, joining it onto BaseURL with exactly one slash in between.
+func (c *AuthenticatedAPIClient) URL(endpoint string) string {
+	return joinURL(c.BaseURL, endpoint)
+}
+
+// authenticator returns the Authenticator requests should be authenticated with, nil if there is none.
+func (c *AuthenticatedAPIClient) authenticator() Authenticator {
+	if c.Auth != nil {
+		return c.Auth
+	}
+	if c.Token != "" {
+		return BearerAuth{Token: c.Token}
+	}
+	return nil
+}
+
+// Delete is a helper function to make a DELETE request to the specified endpoint, authenticated with the client's Authenticator or Token.
 func (c *AuthenticatedAPIClient) Delete(endpoint string, response interface{}) error {
-	return MakeDeleteRequest(c.Client, c.BaseURL, endpoint, c.Token, response)
+	return c.DeleteWithContext(context.Background(), endpoint, response)
+}
+
+// DeleteWithContext is the same as Delete but binds the request to ctx, cancelling ctx aborts the request.
+func (c *AuthenticatedAPIClient) DeleteWithContext(ctx context.Context, endpoint string, response interface{}) error {
+	return c.makeRequest(ctx, http.MethodDelete, endpoint, nil, response)
 }
 
-// Get is a helper function to make a GET request to the specified endpoint. If token is not "" it will be added to the request as a Bearer token.
+// Get is a helper function to make a GET request to the specified endpoint, authenticated with the client's Authenticator or Token.
 func (c *AuthenticatedAPIClient) Get(endpoint string, response interface{}) error {
-	return MakeGetRequest(c.Client, c.BaseURL, endpoint, c.Token, response)
+	return c.GetWithContext(context.Background(), endpoint, response)
+}
+
+// GetWithContext is the same as Get but binds the request to ctx, cancelling ctx aborts the request.
+func (c *AuthenticatedAPIClient) GetWithContext(ctx context.Context, endpoint string, response interface{}) error {
+	return c.makeRequest(ctx, http.MethodGet, endpoint, nil, response)
 }
 
-// Post is a helper function to make a POST request to the specified endpoint. If token is not "" it will be added to the request as a Bearer token.
+// Post is a helper function to make a POST request to the specified endpoint, authenticated with the client's Authenticator or Token.
 func (c *AuthenticatedAPIClient) Post(endpoint string, request, response interface{}) error {
-	return MakePostRequest(c.Client, c.BaseURL, endpoint, c.Token, request, response)
+	return c.PostWithContext(context.Background(), endpoint, request, response)
 }
 
-// Put is a helper function to make a PUT request to the specified endpoint. If token is not "" it will be added to the request as a Bearer token.
+// PostWithContext is the same as Post but binds the request to ctx, cancelling ctx aborts the request.
+func (c *AuthenticatedAPIClient) PostWithContext(ctx context.Context, endpoint string, request, response interface{}) error {
+	return c.makeRequest(ctx, http.MethodPost, endpoint, request, response)
+}
+
+// Put is a helper function to make a PUT request to the specified endpoint, authenticated with the client's Authenticator or Token.
 func (c *AuthenticatedAPIClient) Put(endpoint string, request, response interface{}) error {
-	return MakePutRequest(c.Client, c.BaseURL, endpoint, c.Token, request, response)
+	return c.PutWithContext(context.Background(), endpoint, request, response)
+}
+
+// PutWithContext is the same as Put but binds the request to ctx, cancelling ctx aborts the request.
+func (c *AuthenticatedAPIClient) PutWithContext(ctx context.Context, endpoint string, request, response interface{}) error {
+	return c.makeRequest(ctx, http.MethodPut, endpoint, request, response)
 }
 
 // NoCredFoundError represents an error when no credentials are found
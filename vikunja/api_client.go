@@ -1,8 +1,12 @@
 package vikunja
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
 	"net/http"
-	"strconv"
+	"time"
 
 	"github.com/atropos112/gocore/utils"
 )
@@ -10,8 +14,11 @@ import (
 // Client is the interface for the Vikunja API client
 type Client utils.AuthenticatedAPIClient
 
-// GetVikunjaAPIClient returns a new Vikunja API client
-func GetVikunjaAPIClient(token, apiURL string) (*Client, error) {
+// pageOptions is used for every paged list endpoint, Vikunja caps per_page at 50.
+var pageOptions = utils.PageOptions{PerPage: 50, Prefetch: 2}
+
+// GetVikunjaAPIClient returns a new Vikunja API client, opts are applied on top of the Vikunja defaults
+func GetVikunjaAPIClient(token, apiURL string, opts ...utils.ClientOption) (*Client, error) {
 	// Setting up logging
 	var err error
 
@@ -29,205 +36,315 @@ func GetVikunjaAPIClient(token, apiURL string) (*Client, error) {
 		}
 	}
 
-	return &Client{
-		BaseURL: apiURL,
-		Token:   token,
-		Client:  &http.Client{},
-	}, nil
+	transport, err := utils.TransportOptionsFromEnv("GOCORE_VIKUNJA")
+	if err != nil {
+		return nil, err
+	}
+	if transport.Timeout == 0 {
+		// Without a timeout a hung Vikunja blocks webhook handlers forever.
+		transport.Timeout = time.Minute
+	}
+	httpClient, err := transport.NewHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	defaults := []utils.ClientOption{
+		utils.WithHTTPClient(httpClient),
+		utils.WithRetry(retryPolicy()),
+		// Pagination loops and concurrent webhook callbacks share this limiter, so a small instance is not flooded.
+		utils.WithLimiter(utils.NewRateLimiter(20, 20, 8)),
+		// While Vikunja is down webhook handlers fail fast instead of each waiting on it.
+		utils.WithBreaker(utils.NewCircuitBreaker("vikunja")),
+		// Vikunja's default attachment limit is 20 MB, anything far beyond that is a misbehaving endpoint.
+		utils.WithMaxResponseSize(32 << 20),
+	}
+	c := Client(utils.NewAPIClient(apiURL, token, append(defaults, opts...)...))
+
+	return &c, nil
+}
+
+// retryPolicy is utils.DefaultRetryPolicy without PUT, which Vikunja uses to create webhooks, labels on tasks and
+// the like, so retrying one that reached the server would create a duplicate. Vikunja ignores Idempotency-Key, so
+// TrustIdempotencyKey stays off too.
+func retryPolicy() *utils.RetryPolicy {
+	policy := utils.DefaultRetryPolicy()
+	policy.IdempotentMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodDelete}
+	return policy
+}
+
+// CurrentUser returns the user the client's token belongs to
+func (c *Client) CurrentUser() (User, error) {
+	return c.CurrentUserWithContext(context.Background())
+}
+
+// CurrentUserWithContext is the same as CurrentUser but binds every request to ctx.
+func (c *Client) CurrentUserWithContext(ctx context.Context) (User, error) {
+	apiClient := utils.AuthenticatedAPIClient(*c)
+	return utils.Get[User](ctx, &apiClient, utils.NewEndpoint("user").String())
+}
+
+// RegisterHealthCheck adds a readiness check named "vikunja" to h, it passes while the token can fetch the current user.
+func (c *Client) RegisterHealthCheck(h *utils.HealthRegistry, timeout time.Duration) {
+	h.AddReadinessCheck("vikunja", timeout, func(ctx context.Context) error {
+		_, err := c.CurrentUserWithContext(ctx)
+		return err
+	})
 }
 
 // GetProjects returns a list of projects
 func (c *Client) GetProjects() ([]Project, error) {
-	apiClient := utils.AuthenticatedAPIClient(*c)
-	projects := []Project{}
+	return c.GetProjectsWithContext(context.Background())
+}
 
-	if err := apiClient.Get("/projects", &projects); err != nil {
-		return nil, err
-	}
+// GetProjectsWithContext is the same as GetProjects but binds every request to ctx.
+func (c *Client) GetProjectsWithContext(ctx context.Context) ([]Project, error) {
+	return utils.CollectAll(c.Projects(ctx))
+}
 
-	return projects, nil
+// Projects lazily iterates over all projects, fetching pages as they are consumed.
+func (c *Client) Projects(ctx context.Context) iter.Seq2[Project, error] {
+	apiClient := utils.AuthenticatedAPIClient(*c)
+	return utils.Paginate[Project](ctx, &apiClient, utils.NewEndpoint("projects"), pageOptions)
 }
 
 // GetProject returns a specific project
 func (c *Client) GetProject(projectID int) (Project, error) {
-	apiClient := utils.AuthenticatedAPIClient(*c)
-	project := Project{}
-	projectIDstr := strconv.Itoa(projectID)
-
-	if err := apiClient.Get("/projects/"+projectIDstr, &project); err != nil {
-		return Project{}, err
-	}
+	return c.GetProjectWithContext(context.Background(), projectID)
+}
 
-	return project, nil
+// GetProjectWithContext is the same as GetProject but binds every request to ctx.
+func (c *Client) GetProjectWithContext(ctx context.Context, projectID int) (Project, error) {
+	apiClient := utils.AuthenticatedAPIClient(*c)
+	return utils.Get[Project](ctx, &apiClient, utils.NewEndpoint("projects", projectID).String())
 }
 
 // GetProjectWebhooks returns a list of webhooks for a project
 func (c *Client) GetProjectWebhooks(projectID int) ([]Webhook, error) {
-	apiClient := utils.AuthenticatedAPIClient(*c)
-	webhooks := []Webhook{}
-	projectIDstr := strconv.Itoa(projectID)
+	return c.GetProjectWebhooksWithContext(context.Background(), projectID)
+}
 
-	if err := apiClient.Get("/projects/"+projectIDstr+"/webhooks", &webhooks); err != nil {
-		return nil, err
-	}
+// GetProjectWebhooksWithContext is the same as GetProjectWebhooks but binds every request to ctx.
+func (c *Client) GetProjectWebhooksWithContext(ctx context.Context, projectID int) ([]Webhook, error) {
+	return utils.CollectAll(c.ProjectWebhooks(ctx, projectID))
+}
 
-	return webhooks, nil
+// ProjectWebhooks lazily iterates over the webhooks of a project, fetching pages as they are consumed.
+func (c *Client) ProjectWebhooks(ctx context.Context, projectID int) iter.Seq2[Webhook, error] {
+	apiClient := utils.AuthenticatedAPIClient(*c)
+	return utils.Paginate[Webhook](ctx, &apiClient, utils.NewEndpoint("projects", projectID, "webhooks"), pageOptions)
 }
 
 // CreateProjectWebhook creates a webhook for a project
 func (c *Client) CreateProjectWebhook(projectID int, webhook Webhook) (Webhook, error) {
+	return c.CreateProjectWebhookWithContext(context.Background(), projectID, webhook)
+}
+
+// CreateProjectWebhookWithContext is the same as CreateProjectWebhook but binds every request to ctx.
+func (c *Client) CreateProjectWebhookWithContext(ctx context.Context, projectID int, webhook Webhook) (Webhook, error) {
 	apiClient := utils.AuthenticatedAPIClient(*c)
-	webhookRes := Webhook{}
-	projectIDstr := strconv.Itoa(projectID)
+	return utils.Put[Webhook](ctx, &apiClient, utils.NewEndpoint("projects", projectID, "webhooks").String(), webhook)
+}
 
-	if err := apiClient.Put("/projects/"+projectIDstr+"/webhooks", webhook, &webhookRes); err != nil {
-		return Webhook{}, err
+// CreateProjectWebhookOnce creates the webhook unless the project already has one with the same target URL,
+// or dedup saw the same project and target URL within its window. It reports whether the webhook was created.
+// dedup may be nil to only check the existing webhooks.
+func (c *Client) CreateProjectWebhookOnce(ctx context.Context, dedup *utils.Deduplicator, projectID int, webhook Webhook) (bool, error) {
+	check := func(ctx context.Context) (bool, error) {
+		for existing, err := range c.ProjectWebhooks(ctx, projectID) {
+			if err != nil {
+				return false, err
+			}
+			if existing.TargetURL == webhook.TargetURL {
+				return true, nil
+			}
+		}
+		return false, nil
 	}
-
-	return webhookRes, nil
+	act := func(ctx context.Context) error {
+		_, err := c.CreateProjectWebhookWithContext(ctx, projectID, webhook)
+		return err
+	}
+	return dedup.Do(ctx, fmt.Sprintf("projects/%d/webhooks/%s", projectID, webhook.TargetURL), check, act)
 }
 
 // UpdateProjectWebhook updates a webhook for a project, only can update events (nothing else)
 func (c *Client) UpdateProjectWebhook(projectID int, webhook Webhook) (Webhook, error) {
-	apiClient := utils.AuthenticatedAPIClient(*c)
-	projectIDstr := strconv.Itoa(projectID)
-
-	res := Webhook{}
-	err := apiClient.Post("/projects/"+projectIDstr+"/webhooks/"+strconv.Itoa(webhook.ID), webhook, &res)
+	return c.UpdateProjectWebhookWithContext(context.Background(), projectID, webhook)
+}
 
-	return res, err
+// UpdateProjectWebhookWithContext is the same as UpdateProjectWebhook but binds every request to ctx.
+func (c *Client) UpdateProjectWebhookWithContext(ctx context.Context, projectID int, webhook Webhook) (Webhook, error) {
+	apiClient := utils.AuthenticatedAPIClient(*c)
+	return utils.Post[Webhook](ctx, &apiClient, utils.NewEndpoint("projects", projectID, "webhooks", webhook.ID).String(), webhook)
 }
 
 // DeleteProjectWebhook deletes a webhook for a project
 func (c *Client) DeleteProjectWebhook(projectID, webhookID int) (Webhook, error) {
-	apiClient := utils.AuthenticatedAPIClient(*c)
-	projectIDstr := strconv.Itoa(projectID)
-	webhookIDstr := strconv.Itoa(webhookID)
-
-	resp := Webhook{}
-	err := apiClient.Delete("/projects/"+projectIDstr+"/webhooks/"+webhookIDstr, &resp)
+	return c.DeleteProjectWebhookWithContext(context.Background(), projectID, webhookID)
+}
 
-	return resp, err
+// DeleteProjectWebhookWithContext is the same as DeleteProjectWebhook but binds every request to ctx.
+func (c *Client) DeleteProjectWebhookWithContext(ctx context.Context, projectID, webhookID int) (Webhook, error) {
+	apiClient := utils.AuthenticatedAPIClient(*c)
+	return utils.Delete[Webhook](ctx, &apiClient, utils.NewEndpoint("projects", projectID, "webhooks", webhookID).String())
 }
 
 // GetProjectTasks returns a list of tasks for a project
 func (c *Client) GetProjectTasks(projectID int) ([]Task, error) {
-	apiClient := utils.AuthenticatedAPIClient(*c)
-	tasks := []Task{}
-	projectIDstr := strconv.Itoa(projectID)
-
-	tasks = []Task{}
-	pageCount := 1
-	for {
+	return c.GetProjectTasksWithContext(context.Background(), projectID)
+}
 
-		pageTasks := []Task{}
-		if err := apiClient.Get("/projects/"+projectIDstr+"/tasks?page="+strconv.Itoa(pageCount), &pageTasks); err != nil {
-			return nil, err
-		}
-		if len(pageTasks) == 0 {
-			break
-		}
-		tasks = append(tasks, pageTasks...)
-		pageCount++
-	}
+// GetProjectTasksWithContext is the same as GetProjectTasks but binds every request to ctx.
+func (c *Client) GetProjectTasksWithContext(ctx context.Context, projectID int) ([]Task, error) {
+	return utils.CollectAll(c.ProjectTasks(ctx, projectID))
+}
 
-	return tasks, nil
+// ProjectTasks lazily iterates over the tasks of a project, fetching pages as they are consumed.
+func (c *Client) ProjectTasks(ctx context.Context, projectID int) iter.Seq2[Task, error] {
+	apiClient := utils.AuthenticatedAPIClient(*c)
+	return utils.Paginate[Task](ctx, &apiClient, utils.NewEndpoint("projects", projectID, "tasks"), pageOptions)
 }
 
 // UpdateProject updates a project
 func (c *Client) UpdateProject(project Project) (Project, error) {
-	apiClient := utils.AuthenticatedAPIClient(*c)
-	projectIDstr := strconv.Itoa(project.ID)
-
-	res := Project{}
-	err := apiClient.Post("/projects/"+projectIDstr, project, &res)
+	return c.UpdateProjectWithContext(context.Background(), project)
+}
 
-	return res, err
+// UpdateProjectWithContext is the same as UpdateProject but binds every request to ctx.
+func (c *Client) UpdateProjectWithContext(ctx context.Context, project Project) (Project, error) {
+	apiClient := utils.AuthenticatedAPIClient(*c)
+	return utils.Post[Project](ctx, &apiClient, utils.NewEndpoint("projects", project.ID).String(), project)
 }
 
 // GetTaskComments returns a list of comments for a task
 func (c *Client) GetTaskComments(taskID int) ([]Comment, error) {
-	apiClient := utils.AuthenticatedAPIClient(*c)
-	comments := []Comment{}
-	taskIDstr := strconv.Itoa(taskID)
-
-	if err := apiClient.Get("/tasks/"+taskIDstr+"/comments", &comments); err != nil {
-		return nil, err
-	}
+	return c.GetTaskCommentsWithContext(context.Background(), taskID)
+}
 
-	return comments, nil
+// GetTaskCommentsWithContext is the same as GetTaskComments but binds every request to ctx.
+func (c *Client) GetTaskCommentsWithContext(ctx context.Context, taskID int) ([]Comment, error) {
+	apiClient := utils.AuthenticatedAPIClient(*c)
+	return utils.Get[[]Comment](ctx, &apiClient, utils.NewEndpoint("tasks", taskID, "comments").String())
 }
 
 // GetTask returns a task
 func (c *Client) GetTask(taskID int) (Task, error) {
-	apiClient := utils.AuthenticatedAPIClient(*c)
-	task := Task{}
-	taskIDstr := strconv.Itoa(taskID)
-
-	if err := apiClient.Get("/tasks/"+taskIDstr, &task); err != nil {
-		return Task{}, err
-	}
+	return c.GetTaskWithContext(context.Background(), taskID)
+}
 
-	return task, nil
+// GetTaskWithContext is the same as GetTask but binds every request to ctx.
+func (c *Client) GetTaskWithContext(ctx context.Context, taskID int) (Task, error) {
+	apiClient := utils.AuthenticatedAPIClient(*c)
+	return utils.Get[Task](ctx, &apiClient, utils.NewEndpoint("tasks", taskID).String())
 }
 
 // UpdateTask updates a task
 func (c *Client) UpdateTask(task Task) (Task, error) {
-	apiClient := utils.AuthenticatedAPIClient(*c)
-	resp := Task{}
-	taskIDstr := strconv.Itoa(task.ID)
-
-	err := apiClient.Post("/tasks/"+taskIDstr, task, &resp)
+	return c.UpdateTaskWithContext(context.Background(), task)
+}
 
-	return resp, err
+// UpdateTaskWithContext is the same as UpdateTask but binds every request to ctx.
+func (c *Client) UpdateTaskWithContext(ctx context.Context, task Task) (Task, error) {
+	apiClient := utils.AuthenticatedAPIClient(*c)
+	return utils.Post[Task](ctx, &apiClient, utils.NewEndpoint("tasks", task.ID).String(), task)
 }
 
 // GetAllLabels returns a list of labels for a task
 func (c *Client) GetAllLabels() ([]Label, error) {
+	return c.GetAllLabelsWithContext(context.Background())
+}
+
+// GetAllLabelsWithContext is the same as GetAllLabels but binds every request to ctx.
+func (c *Client) GetAllLabelsWithContext(ctx context.Context) ([]Label, error) {
+	return utils.CollectAll(c.Labels(ctx))
+}
+
+// Labels lazily iterates over all labels, fetching pages as they are consumed.
+func (c *Client) Labels(ctx context.Context) iter.Seq2[Label, error] {
 	apiClient := utils.AuthenticatedAPIClient(*c)
-	labels := []Label{}
+	return utils.Paginate[Label](ctx, &apiClient, utils.NewEndpoint("labels"), pageOptions)
+}
 
-	// per_page is limited up to 50 (default is 50) so need to collect all pages
-	pageCount := 1
-	for {
+// AddLabelToTask adds a label to a task
+func (c *Client) AddLabelToTask(taskID, labelID int) (LabelID, error) {
+	return c.AddLabelToTaskWithContext(context.Background(), taskID, labelID)
+}
 
-		pagelabels := []Label{}
-		if err := apiClient.Get("/labels?page="+strconv.Itoa(pageCount), &pagelabels); err != nil {
-			return nil, err
+// AddLabelToTaskWithContext is the same as AddLabelToTask but binds every request to ctx.
+func (c *Client) AddLabelToTaskWithContext(ctx context.Context, taskID, labelID int) (LabelID, error) {
+	apiClient := utils.AuthenticatedAPIClient(*c)
+	return utils.Put[LabelID](ctx, &apiClient, utils.NewEndpoint("tasks", taskID, "labels").String(), LabelID{ID: labelID})
+}
+
+// AddLabelToTaskOnce adds the label to the task unless the task already has it, or dedup saw the same
+// task and label within its window. It reports whether the label was added. dedup may be nil to only check the task.
+func (c *Client) AddLabelToTaskOnce(ctx context.Context, dedup *utils.Deduplicator, taskID, labelID int) (bool, error) {
+	check := func(ctx context.Context) (bool, error) {
+		task, err := c.GetTaskWithContext(ctx, taskID)
+		if err != nil {
+			return false, err
 		}
-		if len(pagelabels) == 0 {
-			break
+		for _, label := range task.Labels {
+			if label.ID == labelID {
+				return true, nil
+			}
 		}
-		labels = append(labels, pagelabels...)
-		pageCount++
+		return false, nil
 	}
+	act := func(ctx context.Context) error {
+		_, err := c.AddLabelToTaskWithContext(ctx, taskID, labelID)
+		return err
+	}
+	return dedup.Do(ctx, fmt.Sprintf("tasks/%d/labels/%d", taskID, labelID), check, act)
+}
 
-	return labels, nil
+// GetUsersOnAProject returns a list of users added to a project
+func (c *Client) GetUsersOnAProject(projectID int) ([]User, error) {
+	return c.GetUsersOnAProjectWithContext(context.Background(), projectID)
 }
 
-// AddLabelToTask adds a label to a task
-func (c *Client) AddLabelToTask(taskID, labelID int) (LabelID, error) {
+// GetUsersOnAProjectWithContext is the same as GetUsersOnAProject but binds every request to ctx.
+func (c *Client) GetUsersOnAProjectWithContext(ctx context.Context, projectID int) ([]User, error) {
+	return utils.CollectAll(c.UsersOnAProject(ctx, projectID))
+}
+
+// UsersOnAProject lazily iterates over the users added to a project, fetching pages as they are consumed.
+func (c *Client) UsersOnAProject(ctx context.Context, projectID int) iter.Seq2[User, error] {
 	apiClient := utils.AuthenticatedAPIClient(*c)
-	taskIDstr := strconv.Itoa(taskID)
+	return utils.Paginate[User](ctx, &apiClient, utils.NewEndpoint("projects", projectID, "users"), pageOptions)
+}
 
-	req := LabelID{
-		ID: labelID,
-	}
-	resp := LabelID{}
-	err := apiClient.Put("/tasks/"+taskIDstr+"/labels", req, &resp)
+// DownloadTaskAttachment writes the content of a task attachment to w
+func (c *Client) DownloadTaskAttachment(taskID, attachmentID int, w io.Writer) error {
+	return c.DownloadTaskAttachmentWithContext(context.Background(), taskID, attachmentID, w)
+}
 
-	return resp, err
+// DownloadTaskAttachmentWithContext is the same as DownloadTaskAttachment but binds every request to ctx.
+func (c *Client) DownloadTaskAttachmentWithContext(ctx context.Context, taskID, attachmentID int, w io.Writer) error {
+	apiClient := utils.AuthenticatedAPIClient(*c)
+	return apiClient.GetWithContext(ctx, utils.NewEndpoint("tasks", taskID, "attachments", attachmentID).String(), w)
 }
 
-// GetUsersOnAProject returns a list of users added to a project
-func (c *Client) GetUsersOnAProject(projectID int) ([]User, error) {
+// UploadTaskAttachment uploads content as a file called fileName and attaches it to a task
+func (c *Client) UploadTaskAttachment(taskID int, fileName string, content io.Reader) ([]TaskAttachment, error) {
+	return c.UploadTaskAttachmentWithContext(context.Background(), taskID, fileName, content)
+}
+
+// UploadTaskAttachmentWithContext is the same as UploadTaskAttachment but binds every request to ctx.
+func (c *Client) UploadTaskAttachmentWithContext(ctx context.Context, taskID int, fileName string, content io.Reader) ([]TaskAttachment, error) {
 	apiClient := utils.AuthenticatedAPIClient(*c)
-	users := []User{}
-	projectIDstr := strconv.Itoa(projectID)
+	body := utils.MultipartBody{
+		Files: []utils.MultipartFile{{FieldName: "files", FileName: fileName, Content: content}},
+	}
 
-	if err := apiClient.Get("/projects/"+projectIDstr+"/users", &users); err != nil {
+	result, err := utils.Put[attachmentUploadResult](ctx, &apiClient, utils.NewEndpoint("tasks", taskID, "attachments").String(), body)
+	if err != nil {
 		return nil, err
 	}
+	if len(result.Errors) > 0 {
+		return result.Success, fmt.Errorf("uploading %s to task %d: %s", fileName, taskID, result.Errors[0].Message)
+	}
 
-	return users, nil
+	return result.Success, nil
 }
@@ -1,10 +1,14 @@
 package vikunja
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"log/slog"
 	"net/http"
+	"time"
+
+	"github.com/atropos112/gocore/utils"
 )
 
 // ConsumeWebhookCallback consumes a webhook callback and calls the callback function
@@ -41,7 +45,7 @@ func ConsumeWebhookCallback(body io.ReadCloser, callback func(webhook WebhookCal
 	return nil
 }
 
-// RegisterVikunjaWebhookHandler registers a webhook handler for Vikunja Webhook
+// RegisterVikunjaWebhookHandler registers a webhook handler for Vikunja Webhook on http.DefaultServeMux
 /*
 Typical usage is something like:
 l := utils.GetInitLogger()
@@ -50,9 +54,39 @@ if err := vikunja.RegisterVikunjaWebhookHandler("/", SomeWebhookHandler); err !=
 	log.Fatal(err)
 }
 
-utils.RunAPIServer(8080)
+if err := utils.RunAPIServer(8080); err != nil {
+	log.Fatal(err)
+}
+
+New code should register on its own router with RegisterVikunjaWebhookRoute instead.
 */
 func RegisterVikunjaWebhookHandler(path string, callback func(Webhook WebhookCallback, c *Client) error) error {
+	return RegisterVikunjaWebhookHandlerWithContext(path, func(_ context.Context, webhook WebhookCallback, c *Client) error {
+		return callback(webhook, c)
+	})
+}
+
+// RegisterVikunjaWebhookHandlerWithContext is the same as RegisterVikunjaWebhookHandler but hands the incoming request's
+// context to the callback, so client calls made with it are aborted when the webhook request is cancelled or the server shuts down.
+func RegisterVikunjaWebhookHandlerWithContext(path string, callback func(ctx context.Context, Webhook WebhookCallback, c *Client) error) error {
+	return RegisterVikunjaWebhookRoute(http.DefaultServeMux, path, callback)
+}
+
+// RegisterVikunjaWebhookRoute registers a webhook handler for Vikunja Webhook on r, other methods than POST are refused.
+// The webhook metrics are recorded on the builder's registry when r is a *utils.ServerBuilder, on utils.DefaultMetrics otherwise.
+/*
+Typical usage is something like:
+b := utils.NewServerBuilder()
+
+if err := vikunja.RegisterVikunjaWebhookRoute(b, "/vikunja", SomeWebhookHandler); err != nil {
+	log.Fatal(err)
+}
+
+if err := b.Build(":8080").Run(ctx); err != nil {
+	log.Fatal(err)
+}
+*/
+func RegisterVikunjaWebhookRoute(r utils.Router, path string, callback func(ctx context.Context, Webhook WebhookCallback, c *Client) error) error {
 	l := slog.Default().With("path", path)
 	l.Info("Registering vikunja webhook handler")
 
@@ -61,15 +95,33 @@ func RegisterVikunjaWebhookHandler(path string, callback func(Webhook WebhookCal
 		return err
 	}
 
-	http.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
-			err := ConsumeWebhookCallback(r.Body, func(event WebhookCallback) error { return callback(event, c) })
+	metrics := func() *utils.MetricsRegistry { return utils.DefaultMetrics }
+	if b, ok := r.(*utils.ServerBuilder); ok {
+		// Looked up per request, so a registry set with SetMetrics after registering the route is used too.
+		metrics = b.Metrics
+	}
+
+	r.HandleFunc(http.MethodPost+" "+path, func(w http.ResponseWriter, r *http.Request) {
+		registry := metrics()
+		events := registry.Counter("vikunja_webhook_events_total", "Vikunja webhook events processed, by event and result.", "event", "result")
+		duration := registry.Histogram("vikunja_webhook_processing_seconds", "Duration of Vikunja webhook callbacks, by event.", nil, "event")
+
+		err := ConsumeWebhookCallback(r.Body, func(event WebhookCallback) error {
+			start := time.Now()
+			err := callback(r.Context(), event, c)
+			duration.Observe(time.Since(start).Seconds(), string(event.EventName))
+
+			result := "ok"
 			if err != nil {
-				l.Error(err.Error())
-				http.Error(w, err.Error(), http.StatusBadRequest)
+				result = "error"
 			}
-		} else {
-			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			events.Inc(string(event.EventName), result)
+			return err
+		})
+		if err != nil {
+			// The context logger carries the request ID when the server uses utils.RequestIDHandler.
+			utils.LoggerFromContext(r.Context()).Error(err.Error(), "path", path)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 		}
 	})
 
@@ -1,5 +1,7 @@
 package vikunja
 
+import "github.com/atropos112/gocore/utils"
+
 // User is a struct that represents a user in Vikunja
 type User struct {
 	ID       int    `json:"id"`
@@ -105,6 +107,30 @@ type Label struct {
 	Updated     string `json:"updated"`
 }
 
+// TaskAttachment represents a file attached to a task in Vikunja
+type TaskAttachment struct {
+	ID        int            `json:"id"`
+	TaskID    int            `json:"task_id"`
+	File      AttachmentFile `json:"file"`
+	CreatedBy User           `json:"created_by"`
+	Created   string         `json:"created"`
+}
+
+// AttachmentFile describes the file behind a TaskAttachment
+type AttachmentFile struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Mime    string `json:"mime"`
+	Size    int    `json:"size"`
+	Created string `json:"created"`
+}
+
+// attachmentUploadResult is the response to an attachment upload, Vikunja reports per file errors in the body
+type attachmentUploadResult struct {
+	Errors  []utils.APIErrorBody `json:"errors"`
+	Success []TaskAttachment     `json:"success"`
+}
+
 // LabelID is a struct used to communicate to vikunja which label you are after. It is not the ID field in Label though.
 type LabelID struct {
 	ID      int    `json:"label_id"`